@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// EnvAnnotation is the flag annotation with the environment variable used as the flag default
+const EnvAnnotation = "env"
+
+// BindEnv func records env as the environment variable of the flag name in flags
+func BindEnv(flags *pflag.FlagSet, name, env string) {
+	_ = flags.SetAnnotation(name, EnvAnnotation, []string{env})
+}
+
+// flagEnv func returns the environment variable of flag, empty when it has none
+func flagEnv(flag *pflag.Flag) string {
+	if env := flag.Annotations[EnvAnnotation]; len(env) > 0 {
+		return env[0]
+	}
+	return ""
+}
+
+// envValue func returns the value of the environment variable of flag, empty when flag is nil
+// or has no environment variable
+func envValue(flag *pflag.Flag) string {
+	if flag == nil || flagEnv(flag) == "" {
+		return ""
+	}
+	return os.Getenv(flagEnv(flag))
+}
+
+// StringEnvVar func defines a string flag with env as default
+func StringEnvVar(flags *pflag.FlagSet, p *string, name, env, usage string) {
+	StringEnvVarP(flags, p, name, "", env, usage)
+}
+
+// StringEnvVarP func defines a string flag with a shorthand and env as default
+func StringEnvVarP(flags *pflag.FlagSet, p *string, name, shorthand, env, usage string) {
+	flags.StringVarP(p, name, shorthand, os.Getenv(env), usage)
+	BindEnv(flags, name, env)
+}
+
+// checkEnv func records in envErrors the error of parse with the value of env, when it is set,
+// so Validate fails for commands using a flag with an invalid environment variable
+func checkEnv(env string, parse func(value string) error) {
+	value := os.Getenv(env)
+	if value == "" {
+		return
+	}
+	if err := parse(value); err != nil {
+		envErrors[env] = err
+	}
+}
+
+// envError func returns the error of the first invalid environment variable of a flag of cmd,
+// local or inherited, that is not set in the command line
+func envError(cmd *cobra.Command) error {
+	var envErr error
+	check := func(flag *pflag.Flag) {
+		if err := envErrors[flagEnv(flag)]; err != nil && !flag.Changed && envErr == nil {
+			envErr = fmt.Errorf("%s environment variable: %w", flagEnv(flag), err)
+		}
+	}
+	cmd.LocalFlags().VisitAll(check)
+	cmd.InheritedFlags().VisitAll(check)
+	return envErr
+}
+
+// BoolEnvVar func defines a bool flag with env as default, false when env is empty or invalid
+func BoolEnvVar(flags *pflag.FlagSet, p *bool, name, env, usage string) {
+	value := false
+	checkEnv(env, func(env string) (err error) {
+		if value, err = strconv.ParseBool(env); err != nil {
+			return fmt.Errorf("invalid boolean %q", env)
+		}
+		return nil
+	})
+	flags.BoolVar(p, name, value, usage)
+	BindEnv(flags, name, env)
+}
+
+// IntEnvVar func defines an int flag with env as default, or value when env is not a number
+func IntEnvVar(flags *pflag.FlagSet, p *int, name, env string, value int, usage string) {
+	checkEnv(env, func(env string) error {
+		if _, err := strconv.Atoi(env); err != nil {
+			return fmt.Errorf("invalid integer %q", env)
+		}
+		return nil
+	})
+	flags.IntVar(p, name, ParseInt(env, value), usage)
+	BindEnv(flags, name, env)
+}
+
+// DurationEnvVar func defines a duration flag with env as default, or value when env is not a duration
+func DurationEnvVar(flags *pflag.FlagSet, p *time.Duration, name, env string, value time.Duration, usage string) {
+	checkEnv(env, func(env string) error {
+		if _, err := time.ParseDuration(env); err != nil {
+			return fmt.Errorf("invalid duration %q, use a unit like 500ms or 10m", env)
+		}
+		return nil
+	})
+	flags.DurationVar(p, name, ParseDuration(env, value), usage)
+	BindEnv(flags, name, env)
+}
+
+// Float64EnvVar func defines a float64 flag with env as default, or value when env is not a number
+func Float64EnvVar(flags *pflag.FlagSet, p *float64, name, env string, value float64, usage string) {
+	checkEnv(env, func(env string) error {
+		if _, err := strconv.ParseFloat(env, 64); err != nil {
+			return fmt.Errorf("invalid number %q", env)
+		}
+		return nil
+	})
+	flags.Float64Var(p, name, ParseFloat(env, value), usage)
+	BindEnv(flags, name, env)
+}
+
+// StringSliceEnvVar func defines a string slice flag with the comma separated values in env as default
+func StringSliceEnvVar(flags *pflag.FlagSet, p *[]string, name, env, usage string) {
+	flags.StringSliceVar(p, name, ParseList(env), usage)
+	BindEnv(flags, name, env)
+}
+
+// KeyValuesEnvVar func defines a KeyValuesVar flag with the key=value pairs in env as default.
+// When env cannot be parsed the default is empty and Validate returns the error for the
+// commands using the flag without setting it.
+func KeyValuesEnvVar(flags *pflag.FlagSet, p *map[string]string, name, env, usage string) {
+	value := make(map[string]string)
+	checkEnv(env, func(env string) error {
+		data, err := ParseKeyValues(env)
+		if err == nil {
+			value = data
+		}
+		return err
+	})
+	KeyValuesVar(flags, p, name, value, usage)
+	BindEnv(flags, name, env)
+}
@@ -0,0 +1,60 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnvVar(t *testing.T) {
+	t.Setenv("APPLY_FILE", "secrets.yaml")
+	cmd := &cobra.Command{Use: "apply"}
+	var file, namespace string
+	StringEnvVarP(cmd.Flags(), &file, "filename", "f", "APPLY_FILE", "")
+	cmd.Flags().StringVar(&namespace, "secretNamespace", "", "")
+	assert.Equal(t, "secrets.yaml", file)
+	assert.Equal(t, "APPLY_FILE", flagEnv(cmd.Flags().Lookup("filename")))
+	assert.Equal(t, "secrets.yaml", envValue(cmd.Flags().Lookup("filename")))
+	assert.Empty(t, envValue(cmd.Flags().Lookup("secretNamespace")))
+	assert.Empty(t, envValue(nil))
+
+	fillSources(cmd)
+	defer func() { sources = map[string]string{} }()
+	assert.Equal(t, SourceEnv, sources["filename"])
+	assert.Equal(t, SourceDefault, sources["secretNamespace"])
+}
+
+func TestEnvVarErrors(t *testing.T) {
+	t.Setenv("RETRIES", "abc")
+	t.Setenv("RETRY_WAIT", "5")
+	t.Setenv("WATCH", "yes")
+	t.Setenv("MOCK_FAILURE_RATE", "half")
+	defer func() {
+		for _, env := range []string{"RETRIES", "RETRY_WAIT", "WATCH", "MOCK_FAILURE_RATE"} {
+			delete(envErrors, env)
+		}
+	}()
+	root := ConfigureRootCommand()
+	create := &cobra.Command{Use: "create"}
+	var watch bool
+	var rate float64
+	BoolEnvVar(create.Flags(), &watch, "watch", "WATCH", "")
+	Float64EnvVar(create.Flags(), &rate, "failureRate", "MOCK_FAILURE_RATE", 0.5, "")
+	root.AddCommand(create)
+	assert.Equal(t, 3, Retries)
+	assert.False(t, watch)
+	assert.Equal(t, 0.5, rate)
+	ReceiverURL = "http://localhost:8080/secret"
+	defer func() { ReceiverURL = "" }()
+
+	assert.EqualError(t, Validate(create), `MOCK_FAILURE_RATE environment variable: invalid number "half"`)
+	assert.NoError(t, create.Flags().Set("failureRate", "0.1"))
+	assert.EqualError(t, Validate(create), `WATCH environment variable: invalid boolean "yes"`)
+	assert.NoError(t, create.Flags().Set("watch", "true"))
+	assert.EqualError(t, Validate(create), `RETRIES environment variable: invalid integer "abc"`)
+	assert.NoError(t, root.PersistentFlags().Set("retries", "2"))
+	assert.EqualError(t, Validate(create), `RETRY_WAIT environment variable: invalid duration "5", use a unit like 500ms or 10m`)
+	assert.NoError(t, root.PersistentFlags().Set("retryWait", "1s"))
+	assert.NoError(t, Validate(create))
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -15,12 +16,24 @@ var (
 	EncodingRequest string
 	// ReceiverURL string
 	ReceiverURL string
+	// ReceiversFile string
+	ReceiversFile string
+	// Quorum string
+	Quorum string
 	// CommandTimeout string
 	CommandTimeout string
 	// SecretNamespace string
 	SecretNamespace string
 	// StringData map[string]string
 	StringData map[string]string
+	// FromLiterals []string
+	FromLiterals []string
+	// FromFiles []string
+	FromFiles []string
+	// FromEnvFiles []string
+	FromEnvFiles []string
+	// Stdin bool
+	Stdin bool
 	// Labels map[string]string
 	Labels map[string]string
 	// Annotations map[string]string
@@ -49,49 +62,144 @@ var (
 	MiddleName string
 	// Debug bool
 	Debug bool
+	// ApplyFile string
+	ApplyFile string
+	// DryRun bool
+	DryRun bool
+	// ChecksumVersion string
+	ChecksumVersion string
+	// ChecksumMetadata bool
+	ChecksumMetadata bool
+	// Watch bool
+	Watch bool
+	// ResyncPeriod time.Duration
+	ResyncPeriod time.Duration
+	// WatchMaxRetries int
+	WatchMaxRetries int
+	// Prune bool
+	Prune bool
+	// PublisherID string
+	PublisherID string
+	// InventoryName string
+	InventoryName string
+	// Retries int
+	Retries int
+	// RetryWait time.Duration
+	RetryWait time.Duration
+	// RetryMaxWait time.Duration
+	RetryMaxWait time.Duration
+	// RetryPost bool
+	RetryPost bool
+	// Concurrency int
+	Concurrency int
+	// KeyringFile string
+	KeyringFile string
+	// KeyringSecret string
+	KeyringSecret string
+	// KeyActivateIn time.Duration
+	KeyActivateIn time.Duration
+	// KeyGracePeriod time.Duration
+	KeyGracePeriod time.Duration
+	// SigningMode string
+	SigningMode string
+	// PrivateKeyFile string
+	PrivateKeyFile string
+	// KeyID string
+	KeyID string
+	// EncryptionKeyFile string
+	EncryptionKeyFile string
+	// EncryptionKeyID string
+	EncryptionKeyID string
+	// ChecksumKeyFile string
+	ChecksumKeyFile string
+	// DecryptionKeyFile string
+	DecryptionKeyFile string
+	// KeyType string
+	KeyType string
+	// InputFile string
+	InputFile string
+	// DestinationKubeconfig string
+	DestinationKubeconfig string
+	// ManifestKustomization bool
+	ManifestKustomization bool
+	// VaultToken string
+	VaultToken string
+	// MockListen string
+	MockListen string
+	// MockLatency time.Duration
+	MockLatency time.Duration
+	// MockFailFirst int
+	MockFailFirst int
+	// MockFailureRate float64
+	MockFailureRate float64
+	// MockFailureStatus int
+	MockFailureStatus int
+	// PublicKeyFiles []string
+	PublicKeyFiles []string
+	// TLSCAFile string
+	TLSCAFile string
+	// TLSCertFile string
+	TLSCertFile string
+	// TLSKeyFile string
+	TLSKeyFile string
+	// TLSMinVersion string
+	TLSMinVersion string
+	// TLSServerName string
+	TLSServerName string
+	// SigningVersion string
+	SigningVersion string
+	// Output string
+	Output string
+	// MaxInFlight int
+	MaxInFlight int
 )
 
-// ParseStringData func
-func ParseStringData(kind string) map[string]string {
-	data := make(map[string]string)
-	switch kind {
-	case "data":
-		if os.Getenv("STRING_DATA") != "" {
-			data = ParseLabelsArg(os.Getenv("STRING_DATA"))
-		}
-	case "labels":
-		if os.Getenv("LABELS") != "" {
-			data = ParseLabelsArg(os.Getenv("LABELS"))
-		}
-	case "annotations":
-		if os.Getenv("ANNOTATIONS") != "" {
-			data = ParseLabelsArg(os.Getenv("ANNOTATIONS"))
-		}
+// envErrors keeps the errors of environment variables that cannot be parsed by their flag,
+// they are returned by Validate for the commands using them
+var envErrors = map[string]error{}
+
+// ParseDuration func returns the duration from an environment variable or a default value
+func ParseDuration(env string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(env))
+	if err != nil {
+		return defaultValue
 	}
+	return value
+}
 
-	return data
+// ParseInt func returns the integer from an environment variable or a default value
+func ParseInt(env string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(env))
+	if err != nil {
+		return defaultValue
+	}
+	return value
 }
 
-// ParseLabelsArg func returns a map[string]string from a string
-func ParseLabelsArg(labelArg string) map[string]string {
-	labels := map[string]string{}
-	if labelArg == "" {
-		return labels
+// ParseFloat func returns the number from an environment variable or a default value
+func ParseFloat(env string, defaultValue float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(env), 64)
+	if err != nil {
+		return defaultValue
 	}
+	return value
+}
 
-	if strings.Contains(labelArg, ",") {
-		pairs := strings.Split(labelArg, ",")
-		for _, pair := range pairs {
-			parts := strings.Split(pair, "=")
-			if len(parts) == 2 {
-				labels[parts[0]] = parts[1]
-			}
-		}
-	} else {
-		parts := strings.Split(labelArg, "=")
-		labels[parts[0]] = parts[1]
+// ParseList func returns the comma separated values in an environment variable, nil when it is empty
+func ParseList(env string) []string {
+	if os.Getenv(env) == "" {
+		return nil
 	}
+	return strings.Split(os.Getenv(env), ",")
+}
 
+// ParseLabelsArg func returns a map[string]string from key=value pairs parsed by ParseKeyValues,
+// empty when labelArg is invalid. Use ParseKeyValues to get the error.
+func ParseLabelsArg(labelArg string) map[string]string {
+	labels, err := ParseKeyValues(labelArg)
+	if err != nil {
+		return map[string]string{}
+	}
 	return labels
 }
 
@@ -100,33 +208,189 @@ func ConfigureRootCommand() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "secretpublisher",
 		Short: "\nSecret Publisher is a command line tool to interact with Secret Receiver",
-		RunE:  run,
 	}
-	cmd.PersistentFlags().StringVar(&EncodingRequest, "encodingRequest", os.Getenv("ENCODING_REQUEST"), "use ENCODING_REQUEST environment variable")
-	cmd.PersistentFlags().StringVar(&ReceiverURL, "receiverURL", os.Getenv("RECEIVER_URL"), "use RECEIVER_URL environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &ConfigFile, "config", "SECRETPUBLISHER_CONFIG", "YAML config file with named profiles (default secretpublisher/config.yaml in the user config directory), use SECRETPUBLISHER_CONFIG environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &Profile, "profile", "SECRETPUBLISHER_PROFILE", "profile in the config file (default its currentProfile), flags and environment variables take precedence over it, use SECRETPUBLISHER_PROFILE environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &EncodingRequest, "encodingRequest", "ENCODING_REQUEST", "use ENCODING_REQUEST environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &SigningVersion, "signingVersion", "SIGNING_VERSION", "request signature with --encodingRequest key, v1 (timestamp and secret name) or v2 (v1 plus method, path, namespace, body hash and nonce), use SIGNING_VERSION environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &KeyringFile, "keyringFile", "KEYRING_FILE", "YAML file with signing keys used instead of --encodingRequest, use KEYRING_FILE environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &KeyringSecret, "keyringSecret", "KEYRING_SECRET", "kubernetes secret NAMESPACE/NAME with signing keys in keyring.yaml, used instead of --encodingRequest, use KEYRING_SECRET environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &SigningMode, "signingMode", "SIGNING_MODE", "hmac (default) signs with --encodingRequest or the keyring, ed25519 signs with --privateKeyFile, use SIGNING_MODE environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &PrivateKeyFile, "privateKeyFile", "PRIVATE_KEY_FILE", "PEM Ed25519 private key used with --signingMode ed25519, use PRIVATE_KEY_FILE environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &KeyID, "keyID", "KEY_ID", "key id sent with --signingMode ed25519 (default the public key fingerprint), use KEY_ID environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &EncryptionKeyFile, "encryptionKeyFile", "ENCRYPTION_KEY_FILE", "PEM X25519 public key of Secret Receiver, secret data is encrypted to it before sending, use ENCRYPTION_KEY_FILE environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &EncryptionKeyID, "encryptionKeyID", "ENCRYPTION_KEY_ID", "key id sent with encrypted data (default the public key fingerprint), use ENCRYPTION_KEY_ID environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &ChecksumKeyFile, "checksumKeyFile", "CHECKSUM_KEY_FILE", "file with the HMAC key of the checksum sent with encrypted data, keep it from Secret Receiver, use CHECKSUM_KEY_FILE environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &TLSCAFile, "tlsCAFile", "TLS_CA_FILE", "PEM CA bundle trusted for Secret Receiver besides the system CAs, use TLS_CA_FILE environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &TLSCertFile, "tlsCertFile", "TLS_CERT_FILE", "PEM client certificate for mutual TLS, reloaded when it changes, use TLS_CERT_FILE environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &TLSKeyFile, "tlsKeyFile", "TLS_KEY_FILE", "PEM client certificate key for mutual TLS, use TLS_KEY_FILE environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &TLSMinVersion, "tlsMinVersion", "TLS_MIN_VERSION", "minimum TLS version, 1.0, 1.1, 1.2 (default) or 1.3, use TLS_MIN_VERSION environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &TLSServerName, "tlsServerName", "TLS_SERVER_NAME", "server name used for SNI and to verify the Secret Receiver certificate, use TLS_SERVER_NAME environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &ReceiverURL, "receiverURL", "RECEIVER_URL", "destination URL: http:// or https:// (or secretreceiver://) for Secret Receiver, vault:// for Vault KV v2, k8s://CONTEXT for another cluster, file:///DIR or file:DIR for manifests, use RECEIVER_URL environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &ReceiversFile, "receiversFile", "RECEIVERS_FILE", "YAML file with many named receivers to publish to at the same time, instead of receiverURL, use RECEIVERS_FILE environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &Quorum, "quorum", "QUORUM", "receivers that must succeed with receiversFile: all (default), majority or a number, use QUORUM environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &DestinationKubeconfig, "destinationKubeconfig", "DESTINATION_KUBECONFIG", "kubeconfig file for k8s://CONTEXT destinations, use DESTINATION_KUBECONFIG environment variable")
+	BoolEnvVar(cmd.PersistentFlags(), &ManifestKustomization, "manifestKustomization", "MANIFEST_KUSTOMIZATION", "write kustomization.yaml with the manifests written in file: destinations, use MANIFEST_KUSTOMIZATION environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &VaultToken, "vaultToken", "VAULT_TOKEN", "token for vault:// destinations, use VAULT_TOKEN environment variable")
 	cmd.PersistentFlags().StringVar(&TestRun, "testRun", "false", "use TESTRUN environment variable")
 	cmd.PersistentFlags().BoolVar(&LocalKubeconfig, "localKubeconfig", false, "use local kubeconfig file")
 	cmd.PersistentFlags().BoolVar(&Debug, "debug", false, "add --debug in the command")
-	cmd.PersistentFlags().StringVar(&CommandTimeout, "commandTimeout", os.Getenv("COMMAND_TIMEOUT"), "use COMMAND_TIMEOUT environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &ChecksumVersion, "checksumVersion", "CHECKSUM_VERSION", "checksum version sent to Secret Receiver, v1 (values only) or v2 (key names and values), use CHECKSUM_VERSION environment variable")
+	BoolEnvVar(cmd.PersistentFlags(), &ChecksumMetadata, "checksumMetadata", "CHECKSUM_METADATA", "include labels and annotations in checksum v2, use CHECKSUM_METADATA environment variable")
+	IntEnvVar(cmd.PersistentFlags(), &Retries, "retries", "RETRIES", 3, "retries for GET, PUT and DELETE requests that fail with connection errors, 429 or 5xx, use RETRIES environment variable")
+	DurationEnvVar(cmd.PersistentFlags(), &RetryWait, "retryWait", "RETRY_WAIT", 500*time.Millisecond, "wait before the first retry, doubled with jitter in each retry, use RETRY_WAIT environment variable")
+	DurationEnvVar(cmd.PersistentFlags(), &RetryMaxWait, "retryMaxWait", "RETRY_MAX_WAIT", 30*time.Second, "maximum wait between retries, also used for Retry-After, use RETRY_MAX_WAIT environment variable")
+	BoolEnvVar(cmd.PersistentFlags(), &RetryPost, "retryPost", "RETRY_POST", "retry POST requests too, sending the same Idempotency-Key header in each attempt, use RETRY_POST environment variable")
+	IntEnvVar(cmd.PersistentFlags(), &MaxInFlight, "maxInFlight", "MAX_IN_FLIGHT", 0, "maximum requests to Secret Receiver at the same time, 0 means no limit besides --concurrency, use MAX_IN_FLIGHT environment variable")
+	StringEnvVarP(cmd.PersistentFlags(), &Output, "output", "o", "OUTPUT", "output format: text (default), json, yaml or table, use OUTPUT environment variable")
+	StringEnvVar(cmd.PersistentFlags(), &CommandTimeout, "commandTimeout", "COMMAND_TIMEOUT", "use COMMAND_TIMEOUT environment variable")
 	return cmd
 }
 
-// run func do everything
-func run(cmd *cobra.Command, args []string) error {
-	if ReceiverURL == "" {
-		return fmt.Errorf("ReceiverURL is empty")
+// SkipReceiver is the command annotation for commands that do not talk to Secret Receiver
+const SkipReceiver = "skipReceiver"
+
+// ShowEnvErrors is the command annotation for commands that print invalid environment
+// variables themselves, so Validate does not fail with them
+const ShowEnvErrors = "showEnvErrors"
+
+// NeedsReceiver func returns false for commands annotated with SkipReceiver and for
+// cobra commands like help and completion
+func NeedsReceiver(cmd *cobra.Command) bool {
+	for c := cmd; c != nil; c = c.Parent() {
+		if c.Annotations[SkipReceiver] == "true" {
+			return false
+		}
+		if c.Name() == "help" || c.Name() == "completion" || c.Name() == cobra.ShellCompRequestCmd {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate func checks the global configuration after flags are parsed and fills defaults.
+// It must run before any repository is created.
+func Validate(cmd *cobra.Command) error {
+	if cmd.Annotations[ShowEnvErrors] != "true" {
+		if err := envError(cmd); err != nil {
+			return err
+		}
 	}
 	if EncodingRequest == "" {
 		EncodingRequest = "disabled"
 	}
-	tmpTimeout, err := strconv.Atoi(CommandTimeout)
-	if err != nil {
-		tmpTimeout = 15
+	tmpTimeout := 15
+	if CommandTimeout != "" {
+		var err error
+		tmpTimeout, err = strconv.Atoi(CommandTimeout)
+		if err != nil || tmpTimeout <= 0 {
+			return fmt.Errorf("commandTimeout must be a number of seconds greater than zero, got %q", CommandTimeout)
+		}
+	}
+	PublisherTimeout = time.Duration(tmpTimeout) * time.Second
+	switch ChecksumVersion {
+	case "", "v1", "v2":
+	default:
+		return fmt.Errorf("checksumVersion must be v1 or v2, got %q", ChecksumVersion)
+	}
+	if KeyringFile != "" && KeyringSecret != "" {
+		return fmt.Errorf("use only one of keyringFile and keyringSecret")
+	}
+	if KeyringSecret != "" {
+		parts := strings.Split(KeyringSecret, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("keyringSecret must be NAMESPACE/NAME, got %q", KeyringSecret)
+		}
+	}
+	switch SigningMode {
+	case "":
+		SigningMode = "hmac"
+	case "hmac", "ed25519":
+	default:
+		return fmt.Errorf("signingMode must be hmac or ed25519, got %q", SigningMode)
+	}
+	if SigningMode == "ed25519" && (KeyringFile != "" || KeyringSecret != "") {
+		return fmt.Errorf("keyringFile and keyringSecret are only used with signingMode hmac")
+	}
+	if (TLSCertFile == "") != (TLSKeyFile == "") {
+		return fmt.Errorf("tlsCertFile and tlsKeyFile must be used together")
+	}
+	switch TLSMinVersion {
+	case "", "1.0", "1.1", "1.2", "1.3":
+	default:
+		return fmt.Errorf("tlsMinVersion must be 1.0, 1.1, 1.2 or 1.3, got %q", TLSMinVersion)
+	}
+	switch SigningVersion {
+	case "":
+		SigningVersion = "v1"
+		if SigningMode == "ed25519" {
+			SigningVersion = "v2"
+		}
+	case "v1":
+		if SigningMode == "ed25519" {
+			return fmt.Errorf("signingMode ed25519 needs signingVersion v2, a v1 signature can be replayed with another body")
+		}
+	case "v2":
+	default:
+		return fmt.Errorf("signingVersion must be v1 or v2, got %q", SigningVersion)
+	}
+	switch Output {
+	case "":
+		Output = "text"
+	case "text", "json", "yaml", "table":
+	default:
+		return fmt.Errorf("output must be text, json, yaml or table, got %q", Output)
+	}
+	if Retries < 0 {
+		return fmt.Errorf("retries must not be negative, got %d", Retries)
+	}
+	if RetryWait < 0 || RetryMaxWait < 0 {
+		return fmt.Errorf("retryWait and retryMaxWait must not be negative")
+	}
+	if MaxInFlight < 0 {
+		return fmt.Errorf("maxInFlight must not be negative, got %d", MaxInFlight)
+	}
+	if Concurrency < 0 {
+		return fmt.Errorf("concurrency must not be negative, got %d", Concurrency)
+	}
+	switch Quorum {
+	case "", "all", "majority":
+	default:
+		if size, err := strconv.Atoi(Quorum); err != nil || size < 1 {
+			return fmt.Errorf("quorum must be all, majority or a number greater than zero, got %q", Quorum)
+		}
+	}
+	if err := keyValuesError(cmd.Flags()); err != nil {
+		return err
+	}
+	if _, err := ParseKeyValues(NewLabels); err != nil {
+		return fmt.Errorf("newLabels: %w", err)
+	}
+	if _, err := ParseKeyValues(NewAnnotations); err != nil {
+		return fmt.Errorf("newAnnotations: %w", err)
+	}
+	if !NeedsReceiver(cmd) {
+		return nil
+	}
+	if EncryptionKeyFile != "" && ChecksumKeyFile == "" {
+		return fmt.Errorf("checksumKeyFile is required with encryptionKeyFile, a plain checksum can be brute forced to find the encrypted data")
+	}
+	if ReceiversFile != "" {
+		if ReceiverURL != "" {
+			return fmt.Errorf("use only one of receiverURL and receiversFile")
+		}
+		return nil
+	}
+	if ReceiverURL == "" {
+		return fmt.Errorf("ReceiverURL is empty, use --receiverURL or RECEIVER_URL environment variable, or --receiversFile")
+	}
+	parsed, err := url.Parse(ReceiverURL)
+	if err != nil || parsed.Scheme == "" || (parsed.Host == "" && parsed.Path == "" && (parsed.Scheme != "file" || parsed.Opaque == "")) {
+		return fmt.Errorf("ReceiverURL must be a URL like https://HOST/PATH, got %q", ReceiverURL)
+	}
+	ReceiverURL = strings.TrimRight(ReceiverURL, "/")
+	if SigningMode == "ed25519" && PrivateKeyFile == "" {
+		return fmt.Errorf("signingMode ed25519 needs --privateKeyFile or PRIVATE_KEY_FILE environment variable")
 	}
-	PublisherTimeout = time.Duration(tmpTimeout)
-	// errManage := usecase.ManageSecret()
-	// if errManage != nil {
-	// 	return errManage
-	// }
 	return nil
 }
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	root := ConfigureRootCommand()
+	create := &cobra.Command{Use: "create"}
+	version := &cobra.Command{Use: "version", Annotations: map[string]string{SkipReceiver: "true"}}
+	root.AddCommand(create, version)
+
+	ReceiverURL = ""
+	CommandTimeout = ""
+	assert.Error(t, Validate(create))
+	assert.NoError(t, Validate(version))
+	assert.Equal(t, "disabled", EncodingRequest)
+	assert.Equal(t, 15*time.Second, PublisherTimeout)
+
+	ReceiverURL = "localhost:8080"
+	assert.Error(t, Validate(create))
+	ReceiverURL = "http://localhost:8080/secret/"
+	assert.NoError(t, Validate(create))
+	assert.Equal(t, "http://localhost:8080/secret", ReceiverURL)
+	ReceiverURL = "file:manifests"
+	assert.NoError(t, Validate(create))
+	ReceiverURL = "http://localhost:8080/secret"
+
+	ReceiversFile = "receivers.yaml"
+	assert.Error(t, Validate(create))
+	ReceiverURL = ""
+	assert.NoError(t, Validate(create))
+	Quorum = "majority"
+	assert.NoError(t, Validate(create))
+	Quorum = "0"
+	assert.Error(t, Validate(create))
+	Quorum, ReceiversFile, ReceiverURL = "", "", "http://localhost:8080/secret"
+
+	CommandTimeout = "30"
+	assert.NoError(t, Validate(create))
+	assert.Equal(t, 30*time.Second, PublisherTimeout)
+	CommandTimeout = "abc"
+	assert.Error(t, Validate(create))
+	CommandTimeout = ""
+
+	Concurrency = 0
+	assert.NoError(t, Validate(create))
+	Concurrency = -1
+	assert.EqualError(t, Validate(create), "concurrency must not be negative, got -1")
+	Concurrency = 1
+
+	ChecksumVersion = "v3"
+	assert.Error(t, Validate(create))
+	ChecksumVersion = ""
+
+	SigningVersion = "v3"
+	assert.Error(t, Validate(create))
+	SigningVersion = ""
+	assert.NoError(t, Validate(create))
+	assert.Equal(t, "v1", SigningVersion)
+
+	KeyringSecret = "keyring"
+	assert.Error(t, Validate(create))
+	KeyringSecret = "default/keyring"
+	assert.NoError(t, Validate(create))
+	KeyringFile = "keyring.yaml"
+	assert.Error(t, Validate(create))
+	KeyringFile, KeyringSecret = "", ""
+
+	SigningMode, SigningVersion = "rsa", ""
+	assert.Error(t, Validate(create))
+	SigningMode = "ed25519"
+	assert.Error(t, Validate(create))
+	assert.NoError(t, Validate(version))
+	PrivateKeyFile = "publisher.key"
+	assert.NoError(t, Validate(create))
+	assert.Equal(t, "v2", SigningVersion)
+	SigningVersion = "v1"
+	assert.Error(t, Validate(create))
+	SigningMode, PrivateKeyFile, SigningVersion = "", "", ""
+
+	TLSCertFile = "client.crt"
+	assert.Error(t, Validate(create))
+	TLSKeyFile = "client.key"
+	assert.NoError(t, Validate(create))
+	TLSMinVersion = "1.4"
+	assert.Error(t, Validate(create))
+	TLSCertFile, TLSKeyFile, TLSMinVersion = "", "", ""
+
+	EncryptionKeyFile = "receiver.pub"
+	assert.Error(t, Validate(create))
+	assert.NoError(t, Validate(version))
+	ChecksumKeyFile = "checksum.key"
+	assert.NoError(t, Validate(create))
+	EncryptionKeyFile, ChecksumKeyFile = "", ""
+
+	NewLabels = "team=platform,owner"
+	assert.EqualError(t, Validate(create), `newLabels: invalid key=value list at position 15: missing = after key`)
+	NewLabels = "team=platform,owner=me"
+	assert.NoError(t, Validate(create))
+	NewLabels = ""
+
+	Output = ""
+	assert.NoError(t, Validate(create))
+	assert.Equal(t, "text", Output)
+	Output = "xml"
+	assert.Error(t, Validate(create))
+	Output = "text"
+}
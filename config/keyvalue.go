@@ -0,0 +1,189 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+// ParseKeyValues func parses key=value pairs separated by commas. The value is everything after
+// the first =, so it can have more = like base64 padding or connection strings. A key or value
+// starting with a double quote ends in the next double quote, with \" and \\ escapes inside,
+// one starting with a single quote is taken literally until the next single quote. Outside
+// quotes, a backslash escapes a comma, =, quote or backslash, like in a\,b.
+func ParseKeyValues(input string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	if input == "" {
+		return pairs, nil
+	}
+	p := &keyValueParser{input: []rune(input)}
+	for {
+		start := p.pos
+		key, err := p.token(true)
+		if err != nil {
+			return nil, err
+		}
+		if key == "" {
+			return nil, p.errorAt(start, "empty key")
+		}
+		if p.done() || p.input[p.pos] == ',' {
+			// without = the key can be a value with an unquoted comma, so it is not printed
+			return nil, p.errorAt(start, "missing = after key")
+		}
+		p.pos++
+		value, err := p.token(false)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := pairs[key]; ok {
+			return nil, p.errorAt(start, fmt.Sprintf("duplicate key %q", key))
+		}
+		pairs[key] = value
+		if p.done() {
+			return pairs, nil
+		}
+		p.pos++
+	}
+}
+
+// keyValueParser struct keeps the position in the input of ParseKeyValues
+type keyValueParser struct {
+	input []rune
+	pos   int
+}
+
+func (p *keyValueParser) done() bool {
+	return p.pos >= len(p.input)
+}
+
+// errorAt func returns an error with the position, starting at 1, of the character at pos.
+// Values are secrets, so they are never part of the error.
+func (p *keyValueParser) errorAt(pos int, message string) error {
+	return fmt.Errorf("invalid key=value list at position %d: %s", pos+1, message)
+}
+
+// token func reads a key, until = or comma, or a value, until comma
+func (p *keyValueParser) token(key bool) (string, error) {
+	if !p.done() && (p.input[p.pos] == '"' || p.input[p.pos] == '\'') {
+		return p.quoted(key)
+	}
+	var token strings.Builder
+	for !p.done() {
+		c := p.input[p.pos]
+		if c == ',' || (key && c == '=') {
+			break
+		}
+		if c == '\\' && p.pos+1 < len(p.input) && strings.ContainsRune(`,='"\`, p.input[p.pos+1]) {
+			p.pos++
+			c = p.input[p.pos]
+		}
+		token.WriteRune(c)
+		p.pos++
+	}
+	return token.String(), nil
+}
+
+// quoted func reads a token starting with a quote, that must be followed by a separator
+func (p *keyValueParser) quoted(key bool) (string, error) {
+	start := p.pos
+	quote := p.input[p.pos]
+	p.pos++
+	var token strings.Builder
+	for {
+		if p.done() {
+			return "", p.errorAt(start, "quote is not closed")
+		}
+		c := p.input[p.pos]
+		p.pos++
+		if c == quote {
+			break
+		}
+		if quote == '"' && c == '\\' && !p.done() && (p.input[p.pos] == '"' || p.input[p.pos] == '\\') {
+			c = p.input[p.pos]
+			p.pos++
+		}
+		token.WriteRune(c)
+	}
+	if !p.done() && p.input[p.pos] != ',' && !(key && p.input[p.pos] == '=') {
+		return "", p.errorAt(p.pos, fmt.Sprintf("unexpected %q after closing quote", p.input[p.pos]))
+	}
+	return token.String(), nil
+}
+
+// FormatKeyValues func returns pairs sorted by key in the format read by ParseKeyValues,
+// quoting keys and values when needed
+func FormatKeyValues(pairs map[string]string) string {
+	keys := make([]string, 0, len(pairs))
+	for k := range pairs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	formatted := make([]string, 0, len(keys))
+	for _, k := range keys {
+		formatted = append(formatted, quoteKeyValue(k, "=,")+"="+quoteKeyValue(pairs[k], ","))
+	}
+	return strings.Join(formatted, ",")
+}
+
+// quoteKeyValue func quotes s when it has a separator or a backslash, or starts with a quote
+func quoteKeyValue(s, separators string) string {
+	if !strings.ContainsAny(s, separators+`\`) && !strings.HasPrefix(s, `"`) && !strings.HasPrefix(s, "'") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// keyValuesValue struct is a pflag.Value parsed by ParseKeyValues, repeated flags are merged.
+// Parse errors are kept in err and returned by Validate, pflag would print the whole value.
+type keyValuesValue struct {
+	value   *map[string]string
+	changed bool
+	err     error
+}
+
+func (v *keyValuesValue) Set(s string) error {
+	pairs, err := ParseKeyValues(s)
+	if err != nil {
+		if v.err == nil {
+			v.err = err
+		}
+		return nil
+	}
+	if !v.changed || *v.value == nil {
+		*v.value = pairs
+	} else {
+		for k, value := range pairs {
+			(*v.value)[k] = value
+		}
+	}
+	v.changed = true
+	return nil
+}
+
+func (v *keyValuesValue) Type() string {
+	return "keyValues"
+}
+
+func (v *keyValuesValue) String() string {
+	return "[" + FormatKeyValues(*v.value) + "]"
+}
+
+// KeyValuesVar func defines a flag with key=value pairs parsed by ParseKeyValues in flags.
+// Invalid values are returned by Validate.
+func KeyValuesVar(flags *pflag.FlagSet, p *map[string]string, name string, value map[string]string, usage string) {
+	*p = value
+	flags.Var(&keyValuesValue{value: p}, name, usage)
+}
+
+// keyValuesError func returns the first parse error of a KeyValuesVar flag in flags, without the value
+func keyValuesError(flags *pflag.FlagSet) error {
+	var err error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if value, ok := flag.Value.(*keyValuesValue); ok && value.err != nil && err == nil {
+			err = fmt.Errorf("--%s flag: %w", flag.Name, value.err)
+		}
+	})
+	return err
+}
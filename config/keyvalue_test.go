@@ -0,0 +1,82 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKeyValues(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected map[string]string
+	}{
+		{"", map[string]string{}},
+		{"user=admin", map[string]string{"user": "admin"}},
+		{"a=1,b=2", map[string]string{"a": "1", "b": "2"}},
+		{"token=YWJj==,empty=", map[string]string{"token": "YWJj==", "empty": ""}},
+		{"url=postgres://u:p@host/db?sslmode=require&x=y", map[string]string{"url": "postgres://u:p@host/db?sslmode=require&x=y"}},
+		{`dsn="host=db,port=5432",user=admin`, map[string]string{"dsn": "host=db,port=5432", "user": "admin"}},
+		{`msg="say \"hi\" \\ \n"`, map[string]string{"msg": `say "hi" \ \n`}},
+		{`raw='a,"b"\'`, map[string]string{"raw": `a,"b"\`}},
+		{`list=a\,b,k\=1=v`, map[string]string{"list": "a,b", "k=1": "v"}},
+		{`owner=Bob's team,path=C:\tmp`, map[string]string{"owner": "Bob's team", "path": `C:\tmp`}},
+		{`"my key"="v"`, map[string]string{"my key": "v"}},
+	}
+	for _, test := range tests {
+		result, err := ParseKeyValues(test.input)
+		assert.NoError(t, err, test.input)
+		assert.Equal(t, test.expected, result, test.input)
+		formatted, err := ParseKeyValues(FormatKeyValues(result))
+		assert.NoError(t, err, test.input)
+		assert.Equal(t, test.expected, formatted, test.input)
+	}
+
+	errors := map[string]string{
+		"user":              `invalid key=value list at position 1: missing = after key`,
+		"a=1,b":             `invalid key=value list at position 5: missing = after key`,
+		"a=1,":              "invalid key=value list at position 5: empty key",
+		"=secret":           "invalid key=value list at position 1: empty key",
+		"a=1,a=2":           `invalid key=value list at position 5: duplicate key "a"`,
+		`a="secret`:         "invalid key=value list at position 3: quote is not closed",
+		`a="secret"x,b=1`:   `invalid key=value list at position 11: unexpected 'x' after closing quote`,
+		`a='s3cr3t',b='s3c`: "invalid key=value list at position 14: quote is not closed",
+	}
+	for input, expected := range errors {
+		_, err := ParseKeyValues(input)
+		assert.EqualError(t, err, expected, input)
+	}
+}
+
+func TestKeyValuesVar(t *testing.T) {
+	var labels map[string]string
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	KeyValuesVar(flags, &labels, "labels", map[string]string{"from": "env"}, "")
+	assert.Equal(t, "[from=env]", flags.Lookup("labels").Value.String())
+	assert.NoError(t, flags.Parse([]string{"--labels", "a=1,b=x=y", "--labels", `c="1,2"`}))
+	assert.Equal(t, map[string]string{"a": "1", "b": "x=y", "c": "1,2"}, labels)
+	assert.Equal(t, `[a=1,b=x=y,c="1,2"]`, flags.Lookup("labels").Value.String())
+	assert.NoError(t, keyValuesError(flags))
+	// the error is returned by Validate, without the value
+	assert.NoError(t, flags.Parse([]string{"--labels", "s3cr3t,x=1"}))
+	assert.EqualError(t, keyValuesError(flags), "--labels flag: invalid key=value list at position 1: missing = after key")
+}
+
+func TestKeyValuesEnvVarError(t *testing.T) {
+	t.Setenv("STRING_DATA", "user=admin,password")
+	defer delete(envErrors, "STRING_DATA")
+	root := ConfigureRootCommand()
+	create := &cobra.Command{Use: "create"}
+	var data map[string]string
+	KeyValuesEnvVar(create.Flags(), &data, "stringData", "STRING_DATA", "")
+	root.AddCommand(create)
+	assert.Empty(t, data)
+	ReceiverURL = "http://localhost:8080/secret"
+	defer func() { ReceiverURL = "" }()
+	assert.EqualError(t, Validate(create), `STRING_DATA environment variable: invalid key=value list at position 12: missing = after key`)
+	assert.NoError(t, create.Flags().Set("stringData", "user=admin"))
+	assert.NoError(t, Validate(create))
+	assert.NoError(t, Validate(root))
+}
@@ -0,0 +1,244 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+// Sources of a setting, from the highest precedence
+const (
+	SourceFlag    = "flag"
+	SourceEnv     = "env"
+	SourceProfile = "profile"
+	SourceDefault = "default"
+)
+
+// redacted replaces secret values in View
+const redacted = "REDACTED"
+
+var (
+	// ConfigFile string
+	ConfigFile string
+	// Profile string
+	Profile string
+	// sources has where each setting came from, filled by LoadProfile
+	sources = map[string]string{}
+	// profileSettings has the settings of the loaded profile
+	profileSettings = map[string]string{}
+)
+
+// secretSettings are redacted in View
+var secretSettings = map[string]bool{
+	"encodingRequest": true,
+	"from-literal":    true,
+	"stringData":      true,
+	"vaultToken":      true,
+}
+
+// profileFile struct is the configuration file with named profiles. Each profile has
+// flag names and their values, maps are used for flags like --labels.
+type profileFile struct {
+	CurrentProfile string                            `yaml:"currentProfile"`
+	Profiles       map[string]map[string]interface{} `yaml:"profiles"`
+}
+
+// Setting struct is one effective setting printed by config view
+type Setting struct {
+	Name   string `json:"name" yaml:"name"`
+	Value  string `json:"value" yaml:"value"`
+	Source string `json:"source" yaml:"source"`
+	// Error is set when the environment variable of the setting cannot be parsed
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// ConfigView struct is the effective configuration printed by config view
+type ConfigView struct {
+	ConfigFile string     `json:"configFile,omitempty" yaml:"configFile,omitempty"`
+	Profile    string     `json:"profile,omitempty" yaml:"profile,omitempty"`
+	Settings   []*Setting `json:"settings" yaml:"settings"`
+}
+
+// defaultConfigFile func returns secretpublisher/config.yaml in the user config directory
+func defaultConfigFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "secretpublisher", "config.yaml")
+}
+
+// LoadProfile func applies the profile selected by --profile, or currentProfile in the config file,
+// to the flags of cmd. Precedence is flag, environment variable, profile and default, so the
+// profile only sets flags not changed in the command line and without environment variable.
+// Every setting in the profile must be a flag of some command.
+func LoadProfile(cmd *cobra.Command) error {
+	sources = map[string]string{}
+	profileSettings = map[string]string{}
+	file := ConfigFile
+	if file == "" {
+		file = defaultConfigFile()
+		if _, err := os.Stat(file); err != nil {
+			file = ""
+		}
+	}
+	if file == "" {
+		if Profile != "" {
+			return fmt.Errorf("profile %s needs a config file, use --config or SECRETPUBLISHER_CONFIG environment variable", Profile)
+		}
+		fillSources(cmd)
+		return nil
+	}
+	ConfigFile = file
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %v", err)
+	}
+	parsed := &profileFile{}
+	if err := yaml.UnmarshalStrict(content, parsed); err != nil {
+		return fmt.Errorf("cannot parse config file %s: %v", file, err)
+	}
+	if Profile == "" {
+		Profile = parsed.CurrentProfile
+	}
+	if Profile == "" {
+		fillSources(cmd)
+		return nil
+	}
+	settings, ok := parsed.Profiles[Profile]
+	if !ok {
+		names := make([]string, 0, len(parsed.Profiles))
+		for name := range parsed.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("profile %s not found in %s, profiles: %s", Profile, file, strings.Join(names, ", "))
+	}
+	known := knownFlags(cmd.Root())
+	for name, value := range settings {
+		if known[name] == nil {
+			return fmt.Errorf("profile %s: unknown setting %s", Profile, name)
+		}
+		profileSettings[name] = settingValue(value)
+	}
+	fillSources(cmd)
+	for name, value := range profileSettings {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil || sources[name] != SourceDefault {
+			continue
+		}
+		if err := flag.Value.Set(value); err != nil {
+			return fmt.Errorf("profile %s: invalid %s: %v", Profile, name, err)
+		}
+		sources[name] = SourceProfile
+	}
+	return nil
+}
+
+// fillSources func records if each flag of cmd was set in the command line, by its environment
+// variable (the EnvAnnotation of the flag) or has its default value
+func fillSources(cmd *cobra.Command) {
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		switch {
+		case flag.Changed:
+			sources[flag.Name] = SourceFlag
+		case envValue(flag) != "":
+			sources[flag.Name] = SourceEnv
+		default:
+			sources[flag.Name] = SourceDefault
+		}
+	})
+}
+
+// knownFlags func returns the flags of root and every command below it by name
+func knownFlags(root *cobra.Command) map[string]*pflag.Flag {
+	known := make(map[string]*pflag.Flag)
+	var visit func(c *cobra.Command)
+	visit = func(c *cobra.Command) {
+		c.Flags().VisitAll(func(flag *pflag.Flag) { known[flag.Name] = flag })
+		c.PersistentFlags().VisitAll(func(flag *pflag.Flag) { known[flag.Name] = flag })
+		for _, child := range c.Commands() {
+			visit(child)
+		}
+	}
+	visit(root)
+	delete(known, "config")
+	delete(known, "profile")
+	delete(known, "help")
+	return known
+}
+
+// settingValue func returns a profile value as a flag value, maps are written with FormatKeyValues
+func settingValue(value interface{}) string {
+	m, ok := value.(map[interface{}]interface{})
+	if !ok {
+		return fmt.Sprint(value)
+	}
+	pairs := make(map[string]string, len(m))
+	for k, v := range m {
+		pairs[fmt.Sprint(k)] = fmt.Sprint(v)
+	}
+	return FormatKeyValues(pairs)
+}
+
+// View func returns the effective configuration of cmd, with the flags of cmd and the profile
+// settings of other commands, sorted by name. Secret values are redacted and invalid
+// environment variables are shown with their error.
+func View(cmd *cobra.Command) *ConfigView {
+	view := &ConfigView{ConfigFile: ConfigFile, Profile: Profile}
+	seen := make(map[string]bool)
+	known := knownFlags(cmd.Root())
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if flag.Name == "help" || flag.Name == "config" || flag.Name == "profile" {
+			return
+		}
+		seen[flag.Name] = true
+		source := sources[flag.Name]
+		if source == "" {
+			source = SourceDefault
+		}
+		setting := &Setting{Name: flag.Name, Value: redact(flag.Name, flag.Value.String()), Source: source}
+		invalidEnv(setting, flag)
+		view.Settings = append(view.Settings, setting)
+	})
+	for name, value := range profileSettings {
+		if seen[name] {
+			continue
+		}
+		setting := &Setting{Name: name, Value: redact(name, value), Source: SourceProfile}
+		if env := envValue(known[name]); env != "" {
+			setting.Value, setting.Source = redact(name, env), SourceEnv
+		}
+		invalidEnv(setting, known[name])
+		view.Settings = append(view.Settings, setting)
+	}
+	sort.Slice(view.Settings, func(i, j int) bool { return view.Settings[i].Name < view.Settings[j].Name })
+	return view
+}
+
+// invalidEnv func replaces the value of setting with the error of the environment variable of
+// flag, when it cannot be parsed. It takes precedence over the profile, so neither the profile
+// nor the default value is used and Validate fails for the other commands.
+func invalidEnv(setting *Setting, flag *pflag.Flag) {
+	if flag == nil || flag.Changed {
+		return
+	}
+	if err := envErrors[flagEnv(flag)]; err != nil {
+		setting.Value, setting.Source, setting.Error = "", SourceEnv, fmt.Sprintf("%s environment variable: %v", flagEnv(flag), err)
+	}
+}
+
+// redact func hides the value of secret settings
+func redact(name, value string) string {
+	if !secretSettings[name] || value == "" || value == "[]" || value == "disabled" {
+		return value
+	}
+	return redacted
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadProfile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, ioutil.WriteFile(file, []byte(`currentProfile: staging
+profiles:
+  staging:
+    receiverURL: https://staging.internal/secret
+    checksumVersion: v2
+    encodingRequest: key
+    retries: 7
+    matchKey: password
+    labels:
+      team: platform
+  broken:
+    unknown: value
+`), 0600))
+	run := func(args ...string) (*cobra.Command, error) {
+		root := ConfigureRootCommand()
+		var labels map[string]string
+		var matchKey string
+		create := &cobra.Command{Use: "create", Run: func(cmd *cobra.Command, args []string) {}}
+		create.Flags().StringToStringVar(&labels, "labels", nil, "")
+		scan := &cobra.Command{Use: "scan"}
+		scan.Flags().StringVar(&matchKey, "matchKey", "", "")
+		root.AddCommand(create, scan)
+		cmd, _, err := root.Find(args)
+		assert.NoError(t, err)
+		assert.NoError(t, cmd.ParseFlags(args[1:]))
+		err = LoadProfile(cmd)
+		if err == nil {
+			assert.Equal(t, map[string]string{"team": "platform"}, labels)
+		}
+		return cmd, err
+	}
+	defer func() {
+		ConfigFile, Profile, ReceiverURL, ChecksumVersion, EncodingRequest, Retries = "", "", "", "", "", 3
+	}()
+
+	os.Setenv("RETRIES", "5")
+	defer os.Unsetenv("RETRIES")
+	Retries = 5
+	cmd, err := run("create", "--config", file, "--checksumVersion", "v1")
+	assert.NoError(t, err)
+	assert.Equal(t, "staging", Profile)
+	assert.Equal(t, "https://staging.internal/secret", ReceiverURL)
+	assert.Equal(t, "v1", ChecksumVersion)
+	assert.Equal(t, 5, Retries)
+
+	view := View(cmd)
+	assert.Equal(t, file, view.ConfigFile)
+	settings := map[string]*Setting{}
+	for _, setting := range view.Settings {
+		settings[setting.Name] = setting
+	}
+	assert.Equal(t, SourceProfile, settings["receiverURL"].Source)
+	assert.Equal(t, SourceFlag, settings["checksumVersion"].Source)
+	assert.Equal(t, SourceEnv, settings["retries"].Source)
+	assert.Equal(t, SourceDefault, settings["debug"].Source)
+	assert.Equal(t, redacted, settings["encodingRequest"].Value)
+	assert.Equal(t, "password", settings["matchKey"].Value)
+	assert.NotContains(t, settings, "profile")
+
+	_, err = run("create", "--config", file, "--profile", "broken")
+	assert.Error(t, err)
+	_, err = run("create", "--config", file, "--profile", "missing")
+	assert.Error(t, err)
+	ConfigFile, Profile = "", ""
+	_, err = run("create", "--config", filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestSettingValue(t *testing.T) {
+	assert.Equal(t, "3", settingValue(3))
+	assert.Equal(t, "true", settingValue(true))
+	assert.Equal(t, "a=1,b=2", settingValue(map[interface{}]interface{}{"b": 2, "a": "1"}))
+}
+
+func TestViewInvalidEnv(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("currentProfile: staging\nprofiles:\n  staging:\n    retries: 7\n"), 0600))
+	t.Setenv("RETRIES", "abc")
+	defer delete(envErrors, "RETRIES")
+	defer func() { ConfigFile, Profile, Retries = "", "", 3 }()
+	root := ConfigureRootCommand()
+	view := &cobra.Command{Use: "view", Annotations: map[string]string{ShowEnvErrors: "true", SkipReceiver: "true"}}
+	create := &cobra.Command{Use: "create"}
+	root.AddCommand(view, create)
+	ConfigFile = file
+
+	assert.NoError(t, LoadProfile(view))
+	assert.Equal(t, 3, Retries)
+	assert.NoError(t, Validate(view))
+	settings := map[string]*Setting{}
+	for _, setting := range View(view).Settings {
+		settings[setting.Name] = setting
+	}
+	assert.Equal(t, SourceEnv, settings["retries"].Source)
+	assert.Equal(t, `RETRIES environment variable: invalid integer "abc"`, settings["retries"].Error)
+
+	assert.NoError(t, LoadProfile(create))
+	assert.EqualError(t, Validate(create), `RETRIES environment variable: invalid integer "abc"`)
+}
@@ -0,0 +1,72 @@
+package domain
+
+import (
+	"sync"
+	"time"
+)
+
+// SigningKey struct is one HMAC key used to sign requests to Secret Receiver.
+// A key is valid from NotBefore until NotAfter, both optional.
+type SigningKey struct {
+	ID        string     `json:"id" yaml:"id"`
+	Secret    string     `json:"secret,omitempty" yaml:"secret,omitempty"`
+	NotBefore *time.Time `json:"notBefore,omitempty" yaml:"notBefore,omitempty"`
+	NotAfter  *time.Time `json:"notAfter,omitempty" yaml:"notAfter,omitempty"`
+}
+
+// Keyring struct keeps the signing keys shared with Secret Receiver
+type Keyring struct {
+	Keys []*SigningKey `json:"keys" yaml:"keys"`
+	// mu protects Keys from Replace while requests are signed
+	mu sync.RWMutex
+}
+
+// KeyPair struct is a new private key and its public key in PEM, with the key id
+type KeyPair struct {
+	ID         string `json:"keyID" yaml:"keyID"`
+	PrivateKey string `json:"privateKey,omitempty" yaml:"privateKey,omitempty"`
+	PublicKey  string `json:"publicKey" yaml:"publicKey"`
+}
+
+// Valid func returns true when the key can be used at now
+func (key *SigningKey) Valid(now time.Time) bool {
+	if key.Secret == "" {
+		return false
+	}
+	if key.NotBefore != nil && now.Before(*key.NotBefore) {
+		return false
+	}
+	return key.NotAfter == nil || now.Before(*key.NotAfter)
+}
+
+// Active func returns the valid key with the latest NotBefore, used to sign requests.
+// When many keys have the same NotBefore the last one wins. It returns nil without valid keys.
+func (keyring *Keyring) Active(now time.Time) *SigningKey {
+	keyring.mu.RLock()
+	defer keyring.mu.RUnlock()
+	var active *SigningKey
+	for _, key := range keyring.Keys {
+		if !key.Valid(now) {
+			continue
+		}
+		if active == nil || !notBefore(key).Before(notBefore(active)) {
+			active = key
+		}
+	}
+	return active
+}
+
+// Replace func sets the keys read again from where the keyring was loaded
+func (keyring *Keyring) Replace(keys []*SigningKey) {
+	keyring.mu.Lock()
+	defer keyring.mu.Unlock()
+	keyring.Keys = keys
+}
+
+// notBefore func returns the zero time for keys without NotBefore
+func notBefore(key *SigningKey) time.Time {
+	if key.NotBefore == nil {
+		return time.Time{}
+	}
+	return *key.NotBefore
+}
@@ -0,0 +1,103 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Receivers struct is the receivers file, a list of destinations that receive every secret
+type Receivers struct {
+	// Quorum is all (default), majority or how many receivers must succeed
+	Quorum    string      `json:"quorum,omitempty" yaml:"quorum,omitempty"`
+	Receivers []*Receiver `json:"receivers" yaml:"receivers"`
+}
+
+// Receiver struct is one named destination. Empty fields use the value from flags.
+type Receiver struct {
+	Name            string `json:"name" yaml:"name"`
+	URL             string `json:"url" yaml:"url"`
+	EncodingRequest string `json:"encodingRequest,omitempty" yaml:"encodingRequest,omitempty"`
+	KeyringFile     string `json:"keyringFile,omitempty" yaml:"keyringFile,omitempty"`
+	SigningMode     string `json:"signingMode,omitempty" yaml:"signingMode,omitempty"`
+	PrivateKeyFile  string `json:"privateKeyFile,omitempty" yaml:"privateKeyFile,omitempty"`
+	KeyID           string `json:"keyID,omitempty" yaml:"keyID,omitempty"`
+	// Namespaces maps a source namespace to the namespace used in this receiver
+	Namespaces map[string]string `json:"namespaces,omitempty" yaml:"namespaces,omitempty"`
+	TLS        *ReceiverTLS      `json:"tls,omitempty" yaml:"tls,omitempty"`
+	// Keyring is read from KeyringFile
+	Keyring *Keyring `json:"-" yaml:"-"`
+}
+
+// ReceiverTLS struct has the TLS settings of one receiver
+type ReceiverTLS struct {
+	CAFile     string `json:"caFile,omitempty" yaml:"caFile,omitempty"`
+	CertFile   string `json:"certFile,omitempty" yaml:"certFile,omitempty"`
+	KeyFile    string `json:"keyFile,omitempty" yaml:"keyFile,omitempty"`
+	MinVersion string `json:"minVersion,omitempty" yaml:"minVersion,omitempty"`
+	ServerName string `json:"serverName,omitempty" yaml:"serverName,omitempty"`
+}
+
+// Target struct is the repository created for one receiver
+type Target struct {
+	Name       string
+	Namespaces map[string]string
+	Repository Repository
+}
+
+// Fanout interface is implemented by repositories that send every secret to many targets
+type Fanout interface {
+	Targets() []*Target
+	// Quorum returns how many targets must succeed
+	Quorum() int
+}
+
+// Namespace func returns the namespace used in the target for a source namespace
+func (target *Target) Namespace(namespace string) string {
+	if mapped, ok := target.Namespaces[namespace]; ok && mapped != "" {
+		return mapped
+	}
+	return namespace
+}
+
+// Secret func returns a copy of secret with the namespace used in the target. Encrypted
+// data is bound to its namespace, so it cannot be sent to another one.
+func (target *Target) Secret(secret *Secret) (*Secret, error) {
+	copied := *secret
+	copied.Namespace = target.Namespace(secret.Namespace)
+	if secret.Encrypted != nil && copied.Namespace != secret.Namespace {
+		return nil, fmt.Errorf("encrypted secret %s/%s cannot be sent to namespace %s", secret.Namespace, secret.Name, copied.Namespace)
+	}
+	return &copied, nil
+}
+
+// QuorumSize func returns how many of count targets must succeed with policy
+// all (or empty), majority or a number from 1 to count
+func QuorumSize(policy string, count int) (int, error) {
+	switch policy {
+	case "", "all":
+		return count, nil
+	case "majority":
+		return count/2 + 1, nil
+	}
+	size, err := strconv.Atoi(policy)
+	if err != nil || size < 1 || size > count {
+		return 0, fmt.Errorf("quorum must be all, majority or a number from 1 to %d, got %q", count, policy)
+	}
+	return size, nil
+}
+
+// QuorumError func returns nil when at least quorum targets succeeded, or the errors
+// of the targets that failed. errs has one entry per target, nil when it succeeded.
+func QuorumError(quorum int, errs []error) error {
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	if len(errs)-failed >= quorum {
+		return nil
+	}
+	return fmt.Errorf("%d of %d receivers succeeded, quorum is %d: %w", len(errs)-failed, len(errs), quorum, errors.Join(errs...))
+}
@@ -1,25 +1,201 @@
 package domain
 
 import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
 	"github.com/betorvs/secretpublisher/appcontext"
 )
 
-// Secret struct
+// Secret struct. BinaryData has the values that are not valid UTF-8, base64 encoded,
+// and EncryptedBinary replaces it when data is encrypted.
 type Secret struct {
-	Name        string            `json:"name"`
-	Namespace   string            `json:"namespace"`
-	Checksum    string            `json:"checksum"`
-	Data        map[string]string `json:"data"`
-	Labels      map[string]string `json:"labels"`
-	Annotations map[string]string `json:"annotations"`
+	Name            string            `json:"name" yaml:"name"`
+	Namespace       string            `json:"namespace" yaml:"namespace"`
+	Checksum        string            `json:"checksum" yaml:"checksum,omitempty"`
+	ChecksumVersion string            `json:"checksumVersion,omitempty" yaml:"checksumVersion,omitempty"`
+	Type            string            `json:"type,omitempty" yaml:"type,omitempty"`
+	Immutable       bool              `json:"immutable,omitempty" yaml:"immutable,omitempty"`
+	Data            map[string]string `json:"data" yaml:"data"`
+	BinaryData      map[string]string `json:"binaryData,omitempty" yaml:"binaryData,omitempty"`
+	Labels          map[string]string `json:"labels" yaml:"labels,omitempty"`
+	Annotations     map[string]string `json:"annotations" yaml:"annotations,omitempty"`
+	Encrypted       *EncryptedData    `json:"encrypted,omitempty" yaml:"encrypted,omitempty"`
+	EncryptedBinary *EncryptedData    `json:"encryptedBinary,omitempty" yaml:"encryptedBinary,omitempty"`
+}
+
+// RawData func returns Data and the decoded BinaryData as bytes, like kubernetes keeps them
+func (s *Secret) RawData() (map[string][]byte, error) {
+	raw := make(map[string][]byte, len(s.Data)+len(s.BinaryData))
+	for k, v := range s.Data {
+		raw[k] = []byte(v)
+	}
+	for k, v := range s.BinaryData {
+		if _, ok := s.Data[k]; ok {
+			return nil, fmt.Errorf("key %s is in data and binaryData", k)
+		}
+		decoded, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("binaryData %s is not base64: %w", k, err)
+		}
+		raw[k] = decoded
+	}
+	return raw, nil
+}
+
+// SetRawData func sets key in Data when value is valid UTF-8, or base64 encoded in BinaryData
+func (s *Secret) SetRawData(key string, value []byte) {
+	if utf8.Valid(value) {
+		if s.Data == nil {
+			s.Data = make(map[string]string)
+		}
+		s.Data[key] = string(value)
+		return
+	}
+	if s.BinaryData == nil {
+		s.BinaryData = make(map[string]string)
+	}
+	s.BinaryData[key] = base64.StdEncoding.EncodeToString(value)
+}
+
+// Annotations with the checksum in backends that store kubernetes secrets
+const (
+	ChecksumAnnotation        = "secretpublisher.betorvs.github.com/checksum"
+	ChecksumVersionAnnotation = "secretpublisher.betorvs.github.com/checksum-version"
+)
+
+// EncryptedData struct replaces Secret.Data when it is encrypted to a Secret Receiver public key.
+// Binary fields are base64.
+type EncryptedData struct {
+	Algorithm    string `json:"algorithm" yaml:"algorithm"`
+	KeyID        string `json:"keyID" yaml:"keyID"`
+	EphemeralKey string `json:"ephemeralKey" yaml:"ephemeralKey"`
+	Nonce        string `json:"nonce" yaml:"nonce"`
+	Ciphertext   string `json:"ciphertext" yaml:"ciphertext"`
+}
+
+// Actions in Result
+const (
+	ActionCreated   = "created"
+	ActionUpdated   = "updated"
+	ActionUnchanged = "unchanged"
+	ActionDeleted   = "deleted"
+	ActionFailed    = "failed"
+	ActionFound     = "found"
+	ActionNotFound  = "notFound"
+	// ActionInSync, ActionDrifted and ActionMissing are the results of verify
+	ActionInSync  = "inSync"
+	ActionDrifted = "drifted"
+	ActionMissing = "missing"
+)
+
+// Result struct is the outcome of one command for one secret
+type Result struct {
+	Name      string `json:"name" yaml:"name"`
+	Namespace string `json:"namespace" yaml:"namespace"`
+	// Source is the kubernetes object the secret was created from, when scanning
+	Source         string `json:"source,omitempty" yaml:"source,omitempty"`
+	Action         string `json:"action" yaml:"action"`
+	DryRun         bool   `json:"dryRun,omitempty" yaml:"dryRun,omitempty"`
+	ChecksumBefore string `json:"checksumBefore,omitempty" yaml:"checksumBefore,omitempty"`
+	ChecksumAfter  string `json:"checksumAfter,omitempty" yaml:"checksumAfter,omitempty"`
+	Error          string `json:"error,omitempty" yaml:"error,omitempty"`
+	DurationMs     int64  `json:"durationMs" yaml:"durationMs"`
+	// Target is the receiver name in Targets
+	Target string `json:"target,omitempty" yaml:"target,omitempty"`
+	// Targets has one result per receiver when publishing to many receivers
+	Targets []*Result `json:"targets,omitempty" yaml:"targets,omitempty"`
+}
+
+// Report struct is the outcome of one command for many secrets
+type Report struct {
+	// Message is the text printed with the default text output
+	Message string    `json:"message,omitempty" yaml:"message,omitempty"`
+	Results []*Result `json:"results" yaml:"results"`
+	Retries int64     `json:"retries" yaml:"retries"`
+}
+
+// SecretStatus struct is what a Repository knows about one secret
+type SecretStatus struct {
+	Found           bool
+	Checksum        string
+	ChecksumVersion string
+	// Secret is not nil only when the destination returns the whole secret
+	Secret *Secret
+}
+
+var (
+	// ErrNotFound is returned when the secret does not exist in the destination
+	ErrNotFound = errors.New("not found")
+	// ErrUnauthorized is returned when the destination refuses the credentials or signature
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrConflict is returned when the secret changed or already exists in the destination
+	ErrConflict = errors.New("conflict")
+	// ErrServer is returned when the destination fails to process a valid request
+	ErrServer = errors.New("server error")
+	// ErrBadRequest is returned for any other rejected request
+	ErrBadRequest = errors.New("bad request")
+	// ErrDrift is returned by verify when secrets in the destination differ from their sources,
+	// and with many receivers when they do not have the same secret
+	ErrDrift = errors.New("drift")
+)
+
+// StatusError struct keeps the response status from the destination.
+// Use errors.Is with ErrNotFound, ErrUnauthorized, ErrConflict, ErrServer or ErrBadRequest.
+type StatusError struct {
+	StatusCode int
+	Status     string
+	Err        error
+}
+
+// Error func
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Err, e.Status)
+}
+
+// Unwrap func
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// NewStatusError func returns a StatusError wrapping the sentinel error for an HTTP status code
+func NewStatusError(statusCode int, status string) error {
+	var err error
+	switch {
+	case statusCode == http.StatusNotFound:
+		err = ErrNotFound
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		err = ErrUnauthorized
+	case statusCode == http.StatusConflict || statusCode == http.StatusPreconditionFailed:
+		err = ErrConflict
+	case statusCode >= 500:
+		err = ErrServer
+	default:
+		err = ErrBadRequest
+	}
+	if status == "" {
+		status = fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode))
+	}
+	return &StatusError{StatusCode: statusCode, Status: status, Err: err}
 }
 
 // Repository interface
 type Repository interface {
 	appcontext.Component
-	GetSecretByName(secret string, namespace string) (string, error)
-	PostOrPUTSecret(method string, secret string, body []byte) error
-	DeleteSecretK8S(secret string, namespace string) error
+	// GetSecret returns Found false when the secret does not exist
+	GetSecret(ctx context.Context, name string, namespace string) (*SecretStatus, error)
+	CreateSecret(ctx context.Context, secret *Secret) error
+	UpdateSecret(ctx context.Context, secret *Secret) error
+	DeleteSecret(ctx context.Context, name string, namespace string) error
+}
+
+// Retrier interface is implemented by repositories that retry failed requests
+type Retrier interface {
+	RetryCount() int64
 }
 
 // GetRepository func return Repository interface
@@ -0,0 +1,127 @@
+package backend
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/betorvs/secretpublisher/gateway/fanout"
+	"github.com/betorvs/secretpublisher/gateway/kubesecret"
+	"github.com/betorvs/secretpublisher/gateway/manifest"
+	gateway "github.com/betorvs/secretpublisher/gateway/secret"
+	"github.com/betorvs/secretpublisher/gateway/vault"
+	"github.com/betorvs/secretpublisher/utils"
+)
+
+// Options are loaded before the repository is created and passed to every backend
+type Options struct {
+	// Keyring signs requests to Secret Receiver, nil uses config.EncodingRequest
+	Keyring *domain.Keyring
+	// Receiver has the settings of one receiver in the receivers file, nil uses the flags
+	Receiver *domain.Receiver
+}
+
+// Factory creates the domain.Repository for a destination URL
+type Factory func(destination *url.URL, options Options) (domain.Repository, error)
+
+var (
+	factoriesMu sync.Mutex
+	// factories has one Factory by URL scheme
+	factories = map[string]Factory{
+		"http":           newSecretReceiver,
+		"https":          newSecretReceiver,
+		"secretreceiver": newSecretReceiver,
+		"file":           newManifest,
+		"k8s":            newKubeSecret,
+		"vault":          newVault,
+		"vault+http":     newVault,
+	}
+)
+
+// Register func adds or replaces the Factory for scheme
+func Register(scheme string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[scheme] = factory
+}
+
+// Schemes func returns the registered URL schemes in order
+func Schemes() []string {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	schemes := make([]string, 0, len(factories))
+	for scheme := range factories {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// NewRepository func creates the repository registered for the scheme of destination
+func NewRepository(destination string, options Options) (domain.Repository, error) {
+	parsed, err := url.Parse(destination)
+	if err != nil {
+		return nil, utils.ErrorHandler(fmt.Errorf("invalid destination %q: %w", destination, err))
+	}
+	factoriesMu.Lock()
+	factory, ok := factories[parsed.Scheme]
+	factoriesMu.Unlock()
+	if !ok {
+		return nil, utils.ErrorHandler(fmt.Errorf("unknown destination scheme %q, use one of %s", parsed.Scheme, strings.Join(Schemes(), ", ")))
+	}
+	return factory(parsed, options)
+}
+
+// NewFanout func creates the repository that publishes to every receiver, each one with the
+// backend registered for the scheme of its URL and its keyring, or options.Keyring
+func NewFanout(receivers *domain.Receivers, options Options) (domain.Repository, error) {
+	targets := make([]*domain.Target, 0, len(receivers.Receivers))
+	for _, receiver := range receivers.Receivers {
+		receiverOptions := Options{Keyring: options.Keyring, Receiver: receiver}
+		if receiver.Keyring != nil {
+			receiverOptions.Keyring = receiver.Keyring
+		}
+		repo, err := NewRepository(strings.TrimRight(receiver.URL, "/"), receiverOptions)
+		if err != nil {
+			return nil, utils.ErrorHandler(fmt.Errorf("receiver %s: %w", receiver.Name, err))
+		}
+		targets = append(targets, &domain.Target{Name: receiver.Name, Namespaces: receiver.Namespaces, Repository: repo})
+	}
+	quorum, err := domain.QuorumSize(receivers.Quorum, len(targets))
+	if err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
+	return fanout.NewRepository(targets, quorum)
+}
+
+// newSecretReceiver func creates the Secret Receiver backend, secretreceiver:// is https://
+func newSecretReceiver(destination *url.URL, options Options) (domain.Repository, error) {
+	receiverURL := *destination
+	if receiverURL.Scheme == "secretreceiver" {
+		receiverURL.Scheme = "https"
+	}
+	if options.Receiver == nil {
+		return gateway.NewRepository(receiverURL.String(), options.Keyring)
+	}
+	receiver := *options.Receiver
+	receiver.URL = receiverURL.String()
+	return gateway.NewReceiverRepository(&receiver, options.Keyring)
+}
+
+// newVault func creates the Vault KV v2 backend
+func newVault(destination *url.URL, options Options) (domain.Repository, error) {
+	return vault.NewRepository(destination)
+}
+
+// newKubeSecret func creates the backend that writes secrets in another cluster
+func newKubeSecret(destination *url.URL, options Options) (domain.Repository, error) {
+	return kubesecret.NewRepository(destination)
+}
+
+// newManifest func creates the backend that writes secrets as manifests in a directory
+func newManifest(destination *url.URL, options Options) (domain.Repository, error) {
+	return manifest.NewRepository(destination)
+}
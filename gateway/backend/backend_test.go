@@ -0,0 +1,56 @@
+package backend
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/betorvs/secretpublisher/domain"
+	gateway "github.com/betorvs/secretpublisher/gateway/secret"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRepository(t *testing.T) {
+	repo, err := NewRepository("secretreceiver://receiver.internal/secret", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://receiver.internal/secret", repo.(gateway.Repository).URL)
+	repo, err = NewRepository("http://localhost:8080/secret", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080/secret", repo.(gateway.Repository).URL)
+
+	_, err = NewRepository("ftp://localhost/secret", Options{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "vault")
+
+	Register("test", func(destination *url.URL, options Options) (domain.Repository, error) {
+		return gateway.Repository{URL: destination.Host}, nil
+	})
+	repo, err = NewRepository("test://foo", Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "foo", repo.(gateway.Repository).URL)
+	assert.Contains(t, Schemes(), "test")
+}
+
+func TestNewFanout(t *testing.T) {
+	receivers := &domain.Receivers{
+		Quorum: "majority",
+		Receivers: []*domain.Receiver{
+			{Name: "a", URL: "http://a.internal/secret/", EncodingRequest: "key-a"},
+			{Name: "b", URL: "secretreceiver://b.internal/secret", Namespaces: map[string]string{"default": "prod"}},
+		},
+	}
+	repo, err := NewFanout(receivers, Options{})
+	assert.NoError(t, err)
+	fanout := repo.(domain.Fanout)
+	assert.Equal(t, 2, fanout.Quorum())
+	targets := fanout.Targets()
+	assert.Len(t, targets, 2)
+	assert.Equal(t, "http://a.internal/secret", targets[0].Repository.(gateway.Repository).URL)
+	assert.Equal(t, "key-a", targets[0].Repository.(gateway.Repository).EncodingRequest)
+	assert.Equal(t, "https://b.internal/secret", targets[1].Repository.(gateway.Repository).URL)
+	assert.Equal(t, "prod", targets[1].Namespace("default"))
+
+	receivers.Receivers[1].URL = "ftp://b.internal"
+	_, err = NewFanout(receivers, Options{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "receiver b")
+}
@@ -0,0 +1,138 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/betorvs/secretpublisher/utils"
+)
+
+// Repository struct sends every secret to many targets at the same time and succeeds
+// when at least quorum targets succeed
+type Repository struct {
+	targets []*domain.Target
+	quorum  int
+}
+
+// NewRepository func creates a Repository for targets, quorum is between 1 and len(targets)
+func NewRepository(targets []*domain.Target, quorum int) (Repository, error) {
+	if len(targets) == 0 {
+		return Repository{}, utils.ErrorHandler(errors.New("no receivers to publish to"))
+	}
+	if quorum < 1 || quorum > len(targets) {
+		return Repository{}, utils.ErrorHandler(fmt.Errorf("quorum must be between 1 and %d, got %d", len(targets), quorum))
+	}
+	return Repository{targets: targets, quorum: quorum}, nil
+}
+
+// Targets func returns the targets in the order of the receivers file
+func (repo Repository) Targets() []*domain.Target {
+	return repo.targets
+}
+
+// Quorum func returns how many targets must succeed
+func (repo Repository) Quorum() int {
+	return repo.quorum
+}
+
+// RetryCount func returns the requests retried by every target
+func (repo Repository) RetryCount() int64 {
+	var count int64
+	for _, target := range repo.targets {
+		if retrier, ok := target.Repository.(domain.Retrier); ok {
+			count += retrier.RetryCount()
+		}
+	}
+	return count
+}
+
+// GetSecret func asks every target for the secret and returns the status when the targets
+// that answer agree. It fails when less than quorum targets answer, and with domain.ErrDrift
+// when they have different checksums or some of them do not have the secret.
+func (repo Repository) GetSecret(ctx context.Context, name string, namespace string) (*domain.SecretStatus, error) {
+	statuses := make([]*domain.SecretStatus, len(repo.targets))
+	err := repo.each(func(i int, target *domain.Target) error {
+		var err error
+		statuses[i], err = target.Repository.GetSecret(ctx, name, target.Namespace(namespace))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var first *domain.SecretStatus
+	mismatch := false
+	var described []string
+	for i, status := range statuses {
+		if status == nil {
+			continue
+		}
+		if first == nil {
+			first = status
+		} else if status.Found != first.Found || status.Checksum != first.Checksum {
+			mismatch = true
+		}
+		if status.Found {
+			described = append(described, fmt.Sprintf("%s: checksum %s", repo.targets[i].Name, status.Checksum))
+		} else {
+			described = append(described, fmt.Sprintf("%s: not found", repo.targets[i].Name))
+		}
+	}
+	if mismatch {
+		return nil, utils.ErrorHandler(fmt.Errorf("%w: receivers do not have the same secret %s/%s, %s", domain.ErrDrift, namespace, name, strings.Join(described, ", ")))
+	}
+	return first, nil
+}
+
+// CreateSecret func creates the secret in every target
+func (repo Repository) CreateSecret(ctx context.Context, secret *domain.Secret) error {
+	return repo.each(func(i int, target *domain.Target) error {
+		copied, err := target.Secret(secret)
+		if err != nil {
+			return err
+		}
+		return target.Repository.CreateSecret(ctx, copied)
+	})
+}
+
+// UpdateSecret func updates the secret in every target
+func (repo Repository) UpdateSecret(ctx context.Context, secret *domain.Secret) error {
+	return repo.each(func(i int, target *domain.Target) error {
+		copied, err := target.Secret(secret)
+		if err != nil {
+			return err
+		}
+		return target.Repository.UpdateSecret(ctx, copied)
+	})
+}
+
+// DeleteSecret func deletes the secret in every target
+func (repo Repository) DeleteSecret(ctx context.Context, name string, namespace string) error {
+	return repo.each(func(i int, target *domain.Target) error {
+		return target.Repository.DeleteSecret(ctx, name, target.Namespace(namespace))
+	})
+}
+
+// each func calls send for every target at the same time, with its index in targets, and
+// returns the target errors when less than quorum targets succeed
+func (repo Repository) each(send func(i int, target *domain.Target) error) error {
+	errs := make([]error, len(repo.targets))
+	var wg sync.WaitGroup
+	for i, target := range repo.targets {
+		wg.Add(1)
+		go func(i int, target *domain.Target) {
+			defer wg.Done()
+			if err := send(i, target); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", target.Name, err)
+			}
+		}(i, target)
+	}
+	wg.Wait()
+	if err := domain.QuorumError(repo.quorum, errs); err != nil {
+		return utils.ErrorHandler(err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package fanout
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+// stub keeps the secrets it receives and fails every call when err is set
+type stub struct {
+	mu      *sync.Mutex
+	secrets map[string]*domain.Secret
+	err     error
+}
+
+func newStub(err error) stub {
+	return stub{mu: &sync.Mutex{}, secrets: make(map[string]*domain.Secret), err: err}
+}
+
+func (s stub) GetSecret(ctx context.Context, name string, namespace string) (*domain.SecretStatus, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secret, ok := s.secrets[namespace+"/"+name]
+	if !ok {
+		return &domain.SecretStatus{Found: false}, nil
+	}
+	return &domain.SecretStatus{Found: true, Checksum: secret.Checksum, Secret: secret}, nil
+}
+
+func (s stub) CreateSecret(ctx context.Context, secret *domain.Secret) error {
+	return s.UpdateSecret(ctx, secret)
+}
+
+func (s stub) UpdateSecret(ctx context.Context, secret *domain.Secret) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.secrets[secret.Namespace+"/"+secret.Name] = secret
+	return nil
+}
+
+func (s stub) DeleteSecret(ctx context.Context, name string, namespace string) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.secrets, namespace+"/"+name)
+	return nil
+}
+
+func TestRepository(t *testing.T) {
+	a, b, c := newStub(nil), newStub(nil), newStub(domain.ErrServer)
+	targets := []*domain.Target{
+		{Name: "a", Repository: a},
+		{Name: "b", Repository: b, Namespaces: map[string]string{"default": "prod"}},
+		{Name: "c", Repository: c},
+	}
+	ctx := context.Background()
+	secret := &domain.Secret{Name: "foo", Namespace: "default", Checksum: "abc"}
+
+	repo, err := NewRepository(targets, 2)
+	assert.NoError(t, err)
+	assert.NoError(t, repo.CreateSecret(ctx, secret))
+	assert.Contains(t, a.secrets, "default/foo")
+	assert.Contains(t, b.secrets, "prod/foo")
+	assert.Equal(t, "default", secret.Namespace)
+
+	status, err := repo.GetSecret(ctx, "foo", "default")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", status.Checksum)
+	// every target is asked, not only the first one
+	b.secrets["prod/foo"] = &domain.Secret{Name: "foo", Namespace: "prod", Checksum: "def"}
+	_, err = repo.GetSecret(ctx, "foo", "default")
+	assert.True(t, errors.Is(err, domain.ErrDrift))
+	assert.Contains(t, err.Error(), "a: checksum abc, b: checksum def")
+	delete(b.secrets, "prod/foo")
+	_, err = repo.GetSecret(ctx, "foo", "default")
+	assert.Contains(t, err.Error(), "b: not found")
+	b.secrets["prod/foo"] = secret
+
+	repo, err = NewRepository(targets, 3)
+	assert.NoError(t, err)
+	err = repo.DeleteSecret(ctx, "foo", "default")
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, domain.ErrServer))
+	assert.Contains(t, err.Error(), "2 of 3 receivers succeeded")
+	assert.Empty(t, b.secrets)
+
+	secret.Encrypted = &domain.EncryptedData{}
+	err = repo.UpdateSecret(ctx, secret)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "cannot be sent to namespace prod")
+
+	_, err = NewRepository(targets, 4)
+	assert.Error(t, err)
+	_, err = NewRepository(nil, 1)
+	assert.Error(t, err)
+}
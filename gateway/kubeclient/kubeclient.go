@@ -5,12 +5,17 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/utils"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
@@ -47,6 +52,26 @@ func lazyInit() *kubernetes.Clientset {
 	return clientset
 }
 
+// NewClientset creates a clientset for another cluster, from a kubeconfig file and context.
+// Empty kubeconfig uses KUBECONFIG or ~/.kube/config, empty context uses the current one,
+// and when both are empty it uses the in-cluster config.
+func NewClientset(kubeconfig, kubecontext string) (kubernetes.Interface, error) {
+	var clientConfig *rest.Config
+	var err error
+	if kubeconfig == "" && kubecontext == "" {
+		clientConfig, err = rest.InClusterConfig()
+	} else {
+		rules := clientcmd.NewDefaultClientConfigLoadingRules()
+		rules.ExplicitPath = kubeconfig
+		overrides := &clientcmd.ConfigOverrides{CurrentContext: kubecontext}
+		clientConfig, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load kubernetes config: %v", err)
+	}
+	return kubernetes.NewForConfig(clientConfig)
+}
+
 func homeDir() string {
 	if h := os.Getenv("HOME"); h != "" {
 		return h
@@ -65,7 +90,7 @@ func GetSecrets(namespace, labels string) (*v1.SecretList, error) {
 	if err != nil {
 		return &v1.SecretList{}, fmt.Errorf("Failed to get secrets: %v", err)
 	}
-	fmt.Printf("Number of kubernetes secrets found: %d \n", len(secrets.Items))
+	fmt.Fprintf(utils.Out(), "Number of kubernetes secrets found: %d \n", len(secrets.Items))
 	return secrets, nil
 }
 
@@ -80,6 +105,100 @@ func GetConfigMaps(namespace, labels string) (*v1.ConfigMapList, error) {
 	if err != nil {
 		return &v1.ConfigMapList{}, fmt.Errorf("Failed to get config maps: %v", err)
 	}
-	fmt.Printf("Number of kubernetes config maps found: %d \n", len(cm.Items))
+	fmt.Fprintf(utils.Out(), "Number of kubernetes config maps found: %d \n", len(cm.Items))
+	return cm, nil
+}
+
+// GetSecret return one secret, or nil when it does not exist
+func GetSecret(namespace, name string) (*v1.Secret, error) {
+	kube := lazyInit()
+	secret, err := kube.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get secret %s: %v", name, err)
+	}
+	return secret, nil
+}
+
+// SaveSecret creates a secret, or updates it when it was returned by GetSecret
+func SaveSecret(secret *v1.Secret) error {
+	kube := lazyInit()
+	var err error
+	if secret.ResourceVersion == "" {
+		_, err = kube.CoreV1().Secrets(secret.Namespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+	} else {
+		_, err = kube.CoreV1().Secrets(secret.Namespace).Update(context.TODO(), secret, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to save secret %s: %v", secret.Name, err)
+	}
+	return nil
+}
+
+// GetConfigMap return one config map, or nil when it does not exist
+func GetConfigMap(namespace, name string) (*v1.ConfigMap, error) {
+	kube := lazyInit()
+	cm, err := kube.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get config map %s: %v", name, err)
+	}
 	return cm, nil
 }
+
+// SaveConfigMap creates a config map, or updates it when it was returned by GetConfigMap or
+// SaveConfigMap. It returns the saved config map, with the resource version of the next update.
+func SaveConfigMap(cm *v1.ConfigMap) (*v1.ConfigMap, error) {
+	kube := lazyInit()
+	var saved *v1.ConfigMap
+	var err error
+	if cm.ResourceVersion == "" {
+		saved, err = kube.CoreV1().ConfigMaps(cm.Namespace).Create(context.TODO(), cm, metav1.CreateOptions{})
+	} else {
+		saved, err = kube.CoreV1().ConfigMaps(cm.Namespace).Update(context.TODO(), cm, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to save config map %s: %v", cm.Name, err)
+	}
+	return saved, nil
+}
+
+// WatchSecrets starts a shared informer for secrets from a namespace and labels.
+// It waits for the first list and returns the informer cache.
+func WatchSecrets(ctx context.Context, namespace, labels string, resync time.Duration, handler cache.ResourceEventHandler) (cache.Store, error) {
+	factory := informerFactory(namespace, labels, resync)
+	informer := factory.Core().V1().Secrets().Informer()
+	return startInformer(ctx, factory, informer, handler, "secrets")
+}
+
+// WatchConfigMaps starts a shared informer for config maps from a namespace and labels.
+// It waits for the first list and returns the informer cache.
+func WatchConfigMaps(ctx context.Context, namespace, labels string, resync time.Duration, handler cache.ResourceEventHandler) (cache.Store, error) {
+	factory := informerFactory(namespace, labels, resync)
+	informer := factory.Core().V1().ConfigMaps().Informer()
+	return startInformer(ctx, factory, informer, handler, "config maps")
+}
+
+func informerFactory(namespace, labels string, resync time.Duration) informers.SharedInformerFactory {
+	kube := lazyInit()
+	return informers.NewSharedInformerFactoryWithOptions(kube, resync,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(listOptions *metav1.ListOptions) {
+			listOptions.LabelSelector = labels
+		}),
+	)
+}
+
+func startInformer(ctx context.Context, factory informers.SharedInformerFactory, informer cache.SharedIndexInformer, handler cache.ResourceEventHandler, kind string) (cache.Store, error) {
+	informer.AddEventHandler(handler)
+	factory.Start(ctx.Done())
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return nil, fmt.Errorf("Failed to sync %s cache", kind)
+	}
+	fmt.Fprintf(utils.Out(), "Number of kubernetes %s found: %d \n", kind, len(informer.GetStore().ListKeys()))
+	return informer.GetStore(), nil
+}
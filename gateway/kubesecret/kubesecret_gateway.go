@@ -0,0 +1,220 @@
+package kubesecret
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/betorvs/secretpublisher/gateway/kubeclient"
+	"github.com/betorvs/secretpublisher/utils"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	applycorev1 "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// fieldManager owns the fields written with server-side apply
+const fieldManager = "secretpublisher"
+
+// Repository struct writes secrets directly in a destination kubernetes cluster
+type Repository struct {
+	Client kubernetes.Interface
+}
+
+// NewRepository func creates a Repository from k8s://[CONTEXT], using config.DestinationKubeconfig
+func NewRepository(destination *url.URL) (Repository, error) {
+	client, err := kubeclient.NewClientset(config.DestinationKubeconfig, destination.Host)
+	if err != nil {
+		return Repository{}, utils.ErrorHandler(err)
+	}
+	return Repository{Client: client}, nil
+}
+
+// GetSecret func reads a secret and its checksum annotation
+func (repo Repository) GetSecret(ctx context.Context, name string, namespace string) (*domain.SecretStatus, error) {
+	item, err := repo.Client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return &domain.SecretStatus{Found: false}, nil
+	}
+	if err != nil {
+		return nil, statusError(err)
+	}
+	secret := &domain.Secret{
+		Name:            name,
+		Namespace:       namespace,
+		Checksum:        item.Annotations[domain.ChecksumAnnotation],
+		ChecksumVersion: item.Annotations[domain.ChecksumVersionAnnotation],
+		Type:            string(item.Type),
+		Immutable:       item.Immutable != nil && *item.Immutable,
+		Data:            make(map[string]string, len(item.Data)),
+		Labels:          item.Labels,
+	}
+	for k, v := range item.Data {
+		secret.SetRawData(k, v)
+	}
+	for k, v := range item.Annotations {
+		if k == domain.ChecksumAnnotation || k == domain.ChecksumVersionAnnotation {
+			continue
+		}
+		if secret.Annotations == nil {
+			secret.Annotations = make(map[string]string)
+		}
+		secret.Annotations[k] = v
+	}
+	return &domain.SecretStatus{
+		Found:           true,
+		Checksum:        secret.Checksum,
+		ChecksumVersion: secret.ChecksumVersion,
+		Secret:          secret,
+	}, nil
+}
+
+// CreateSecret func creates a secret, it fails with domain.ErrConflict when it exists
+func (repo Repository) CreateSecret(ctx context.Context, secret *domain.Secret) error {
+	if secret.Encrypted != nil {
+		return utils.ErrorHandler(errEncrypted)
+	}
+	raw, err := data(secret)
+	if err != nil {
+		return err
+	}
+	item := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        secret.Name,
+			Namespace:   secret.Namespace,
+			Labels:      secret.Labels,
+			Annotations: annotations(secret),
+		},
+		Type: secretType(secret),
+		Data: raw,
+	}
+	if secret.Immutable {
+		item.Immutable = &secret.Immutable
+	}
+	_, err = repo.Client.CoreV1().Secrets(secret.Namespace).Create(ctx, item, metav1.CreateOptions{FieldManager: fieldManager})
+	if err != nil {
+		return statusError(err)
+	}
+	return nil
+}
+
+// UpdateSecret func writes a secret with server-side apply, taking the fields owned by others.
+// It fails with domain.ErrConflict when the API server would reject the update, see updateConflict.
+func (repo Repository) UpdateSecret(ctx context.Context, secret *domain.Secret) error {
+	if secret.Encrypted != nil {
+		return utils.ErrorHandler(errEncrypted)
+	}
+	raw, err := data(secret)
+	if err != nil {
+		return err
+	}
+	current, err := repo.Client.CoreV1().Secrets(secret.Namespace).Get(ctx, secret.Name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return statusError(err)
+	}
+	if err == nil {
+		if err := updateConflict(current, secret, raw); err != nil {
+			return utils.ErrorHandler(err)
+		}
+	}
+	apply := applycorev1.Secret(secret.Name, secret.Namespace).
+		WithLabels(secret.Labels).
+		WithAnnotations(annotations(secret)).
+		WithType(secretType(secret)).
+		WithData(raw)
+	if secret.Immutable {
+		apply = apply.WithImmutable(true)
+	}
+	_, err = repo.Client.CoreV1().Secrets(secret.Namespace).Apply(ctx, apply, metav1.ApplyOptions{FieldManager: fieldManager, Force: true})
+	if err != nil {
+		return statusError(err)
+	}
+	return nil
+}
+
+// DeleteSecret func deletes a secret, a missing secret returns domain.ErrNotFound
+func (repo Repository) DeleteSecret(ctx context.Context, name string, namespace string) error {
+	err := repo.Client.CoreV1().Secrets(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil {
+		return statusError(err)
+	}
+	return nil
+}
+
+// errEncrypted is returned when --encryptionKeyFile is used with this backend
+var errEncrypted = errors.New("k8s destination does not keep encrypted data, remove --encryptionKeyFile")
+
+// annotations func returns the secret annotations with the checksum ones
+func annotations(secret *domain.Secret) map[string]string {
+	result := make(map[string]string, len(secret.Annotations)+2)
+	for k, v := range secret.Annotations {
+		result[k] = v
+	}
+	result[domain.ChecksumAnnotation] = secret.Checksum
+	if secret.ChecksumVersion != "" {
+		result[domain.ChecksumVersionAnnotation] = secret.ChecksumVersion
+	}
+	return result
+}
+
+// updateConflict func returns an error wrapping domain.ErrConflict when current cannot become
+// secret: kubernetes does not change the type of a secret, nor the data of an immutable secret
+// or immutable back to false. The secret must be deleted first.
+func updateConflict(current *v1.Secret, secret *domain.Secret, raw map[string][]byte) error {
+	if current.Type != "" && current.Type != secretType(secret) {
+		return fmt.Errorf("%w: secret %s/%s has type %s in the destination and the type cannot change to %s, delete it first",
+			domain.ErrConflict, secret.Namespace, secret.Name, current.Type, secretType(secret))
+	}
+	if current.Immutable == nil || !*current.Immutable {
+		return nil
+	}
+	if !secret.Immutable || !equalData(current.Data, raw) {
+		return fmt.Errorf("%w: secret %s/%s is immutable in the destination and its data cannot change, delete it first",
+			domain.ErrConflict, secret.Namespace, secret.Name)
+	}
+	return nil
+}
+
+// equalData func returns true when both secrets have the same keys and values
+func equalData(a, b map[string][]byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		other, ok := b[k]
+		if !ok || !bytes.Equal(v, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// data func returns the secret data and binary data as bytes
+func data(secret *domain.Secret) (map[string][]byte, error) {
+	raw, err := secret.RawData()
+	if err != nil {
+		return nil, utils.ErrorHandler(fmt.Errorf("%w: %v", domain.ErrBadRequest, err))
+	}
+	return raw, nil
+}
+
+// secretType func returns the secret type, Opaque by default
+func secretType(secret *domain.Secret) v1.SecretType {
+	if secret.Type == "" {
+		return v1.SecretTypeOpaque
+	}
+	return v1.SecretType(secret.Type)
+}
+
+// statusError func wraps kubernetes API errors in the domain errors
+func statusError(err error) error {
+	if status, ok := err.(apierrors.APIStatus); ok {
+		return utils.ErrorHandler(domain.NewStatusError(int(status.Status().Code), status.Status().Message))
+	}
+	return utils.ErrorHandler(err)
+}
@@ -0,0 +1,157 @@
+package kubesecret
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	applycorev1 "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// fakeClient returns a fake clientset that handles server-side apply as a full replace,
+// the fake object tracker does not support it. Like the API server, it rejects a new type
+// and new data or immutable false for immutable secrets.
+func fakeClient(objects ...runtime.Object) *fake.Clientset {
+	client := fake.NewSimpleClientset(objects...)
+	client.PrependReactor("patch", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		patch := action.(k8stesting.PatchAction)
+		if patch.GetPatchType() != types.ApplyPatchType {
+			return false, nil, nil
+		}
+		secret := &v1.Secret{}
+		if err := json.Unmarshal(patch.GetPatch(), secret); err != nil {
+			return true, nil, err
+		}
+		tracker := client.Tracker()
+		gvr := v1.SchemeGroupVersion.WithResource("secrets")
+		obj, err := tracker.Get(gvr, patch.GetNamespace(), patch.GetName())
+		if apierrors.IsNotFound(err) {
+			return true, secret, tracker.Create(gvr, secret, patch.GetNamespace())
+		}
+		current := obj.(*v1.Secret)
+		var invalid field.ErrorList
+		if current.Type != secret.Type {
+			invalid = append(invalid, field.Invalid(field.NewPath("type"), secret.Type, "field is immutable"))
+		}
+		if current.Immutable != nil && *current.Immutable {
+			if secret.Immutable == nil || !*secret.Immutable {
+				invalid = append(invalid, field.Forbidden(field.NewPath("immutable"), "field is immutable when `immutable` is set"))
+			}
+			if !equalData(current.Data, secret.Data) {
+				invalid = append(invalid, field.Forbidden(field.NewPath("data"), "field is immutable when `immutable` is set"))
+			}
+		}
+		if len(invalid) != 0 {
+			return true, nil, apierrors.NewInvalid(v1.SchemeGroupVersion.WithKind("Secret").GroupKind(), secret.Name, invalid)
+		}
+		return true, secret, tracker.Update(gvr, secret, patch.GetNamespace())
+	})
+	return client
+}
+
+func TestRepository(t *testing.T) {
+	repo := Repository{Client: fakeClient()}
+	ctx := context.Background()
+
+	status, err := repo.GetSecret(ctx, "foo", "default")
+	assert.NoError(t, err)
+	assert.False(t, status.Found)
+
+	secret := &domain.Secret{
+		Name:        "foo",
+		Namespace:   "default",
+		Checksum:    "v2:abc",
+		Data:        map[string]string{"user": "admin"},
+		Labels:      map[string]string{"app": "foo"},
+		Annotations: map[string]string{"team": "a"},
+	}
+	assert.NoError(t, repo.CreateSecret(ctx, secret))
+	err = repo.CreateSecret(ctx, secret)
+	assert.True(t, errors.Is(err, domain.ErrConflict))
+
+	status, err = repo.GetSecret(ctx, "foo", "default")
+	assert.NoError(t, err)
+	assert.True(t, status.Found)
+	assert.Equal(t, "v2:abc", status.Checksum)
+	assert.Equal(t, secret.Data, status.Secret.Data)
+	assert.Equal(t, secret.Annotations, status.Secret.Annotations)
+
+	secret.Checksum = "v2:def"
+	secret.Data["user"] = "root"
+	assert.NoError(t, repo.UpdateSecret(ctx, secret))
+	item, err := repo.Client.CoreV1().Secrets("default").Get(ctx, "foo", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, "root", string(item.Data["user"]))
+	assert.Equal(t, "v2:def", item.Annotations[domain.ChecksumAnnotation])
+
+	assert.NoError(t, repo.DeleteSecret(ctx, "foo", "default"))
+	err = repo.DeleteSecret(ctx, "foo", "default")
+	assert.True(t, errors.Is(err, domain.ErrNotFound))
+
+	secret.Encrypted = &domain.EncryptedData{}
+	assert.Error(t, repo.CreateSecret(ctx, secret))
+}
+
+func TestRepositoryTypeAndBinaryData(t *testing.T) {
+	repo := Repository{Client: fakeClient()}
+	ctx := context.Background()
+	secret := &domain.Secret{
+		Name:       "tls",
+		Namespace:  "default",
+		Type:       "kubernetes.io/tls",
+		Immutable:  true,
+		Data:       map[string]string{"tls.crt": "cert"},
+		BinaryData: map[string]string{"keystore": "/wD+"},
+	}
+	assert.NoError(t, repo.CreateSecret(ctx, secret))
+	item, err := repo.Client.CoreV1().Secrets("default").Get(ctx, "tls", metav1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, v1.SecretTypeTLS, item.Type)
+	assert.True(t, *item.Immutable)
+	assert.Equal(t, []byte{0xff, 0x00, 0xfe}, item.Data["keystore"])
+
+	status, err := repo.GetSecret(ctx, "tls", "default")
+	assert.NoError(t, err)
+	assert.Equal(t, secret.Type, status.Secret.Type)
+	assert.True(t, status.Secret.Immutable)
+	assert.Equal(t, secret.Data, status.Secret.Data)
+	assert.Equal(t, secret.BinaryData, status.Secret.BinaryData)
+
+	// only labels and annotations of an immutable secret change
+	secret.Labels = map[string]string{"app": "tls"}
+	assert.NoError(t, repo.UpdateSecret(ctx, secret))
+	secret.Data["tls.crt"] = "new cert"
+	err = repo.UpdateSecret(ctx, secret)
+	assert.True(t, errors.Is(err, domain.ErrConflict))
+	assert.Contains(t, err.Error(), "immutable")
+	secret.Data["tls.crt"] = "cert"
+	secret.Immutable = false
+	err = repo.UpdateSecret(ctx, secret)
+	assert.True(t, errors.Is(err, domain.ErrConflict))
+
+	opaque := &domain.Secret{Name: "basic", Namespace: "default", Type: "kubernetes.io/basic-auth", Data: map[string]string{"username": "admin"}}
+	assert.NoError(t, repo.CreateSecret(ctx, opaque))
+	opaque.Type = ""
+	err = repo.UpdateSecret(ctx, opaque)
+	assert.True(t, errors.Is(err, domain.ErrConflict))
+	assert.Contains(t, err.Error(), "type")
+	// the API server rejects it too
+	_, err = repo.Client.CoreV1().Secrets("default").Apply(ctx, applycorev1.Secret("basic", "default").WithType(v1.SecretTypeOpaque), metav1.ApplyOptions{FieldManager: fieldManager, Force: true})
+	assert.True(t, apierrors.IsInvalid(err))
+
+	secret.Immutable = true
+	secret.BinaryData["keystore"] = "not base64"
+	err = repo.UpdateSecret(ctx, secret)
+	assert.True(t, errors.Is(err, domain.ErrBadRequest))
+}
@@ -0,0 +1,336 @@
+package manifest
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/betorvs/secretpublisher/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// kustomizationFile lists every manifest when config.ManifestKustomization is set
+const kustomizationFile = "kustomization.yaml"
+
+// Repository struct writes each secret as a kubernetes Secret manifest in Dir/NAMESPACE/NAME.yaml
+type Repository struct {
+	Dir string
+	// Kustomization writes Dir/kustomization.yaml with every manifest
+	Kustomization bool
+	// mu serializes writes when secrets are processed concurrently, and guards resources
+	mu *sync.Mutex
+	// resources has the manifests listed in kustomization.yaml
+	resources *resources
+}
+
+// resources struct keeps the manifests listed in kustomization.yaml, Dir is read only once
+// per run to find the manifests written before
+type resources struct {
+	files map[string]bool
+}
+
+// secretManifest is the kubernetes Secret written to disk, keys are sorted so files are stable
+type secretManifest struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   manifestMetadata  `yaml:"metadata"`
+	Type       string            `yaml:"type"`
+	Immutable  bool              `yaml:"immutable,omitempty"`
+	Data       map[string]string `yaml:"data,omitempty"`
+}
+
+type manifestMetadata struct {
+	Name        string            `yaml:"name"`
+	Namespace   string            `yaml:"namespace"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// kustomization is the kustomization.yaml written with config.ManifestKustomization
+type kustomization struct {
+	APIVersion string   `yaml:"apiVersion"`
+	Kind       string   `yaml:"kind"`
+	Resources  []string `yaml:"resources"`
+}
+
+// NewRepository func creates a Repository from file:///DIR for absolute paths or file:DIR for
+// paths relative to the working directory. file://DIR is refused, DIR would be a host.
+func NewRepository(destination *url.URL) (Repository, error) {
+	if destination.Host != "" {
+		return Repository{}, utils.ErrorHandler(fmt.Errorf("file destination cannot have a host, use file:///%s%s for an absolute path or file:%s%s for a relative one", destination.Host, destination.Path, destination.Host, destination.Path))
+	}
+	dir := destination.Path
+	if destination.Opaque != "" {
+		dir = destination.Opaque
+	}
+	if dir == "" {
+		return Repository{}, utils.ErrorHandler(errors.New("file destination needs a directory, like file:///tmp/secrets or file:secrets"))
+	}
+	return newRepository(filepath.Clean(dir), config.ManifestKustomization), nil
+}
+
+// newRepository func creates a Repository writing in dir
+func newRepository(dir string, kustomization bool) Repository {
+	return Repository{Dir: dir, Kustomization: kustomization, mu: &sync.Mutex{}, resources: &resources{}}
+}
+
+// GetSecret func reads the manifest back, the checksum is in its annotation
+func (repo Repository) GetSecret(ctx context.Context, name string, namespace string) (*domain.SecretStatus, error) {
+	file, err := repo.file(name, namespace)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return &domain.SecretStatus{Found: false}, nil
+	}
+	if err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
+	manifest := &secretManifest{}
+	if err := yaml.Unmarshal(content, manifest); err != nil {
+		return nil, utils.ErrorHandler(fmt.Errorf("cannot parse %s: %v", file, err))
+	}
+	secret := &domain.Secret{
+		Name:            name,
+		Namespace:       namespace,
+		Checksum:        manifest.Metadata.Annotations[domain.ChecksumAnnotation],
+		ChecksumVersion: manifest.Metadata.Annotations[domain.ChecksumVersionAnnotation],
+		Type:            manifest.Type,
+		Immutable:       manifest.Immutable,
+		Data:            make(map[string]string, len(manifest.Data)),
+		Labels:          manifest.Metadata.Labels,
+	}
+	for k, v := range manifest.Data {
+		decoded, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, utils.ErrorHandler(fmt.Errorf("cannot decode %s in %s: %v", k, file, err))
+		}
+		secret.SetRawData(k, decoded)
+	}
+	for k, v := range manifest.Metadata.Annotations {
+		if k == domain.ChecksumAnnotation || k == domain.ChecksumVersionAnnotation {
+			continue
+		}
+		if secret.Annotations == nil {
+			secret.Annotations = make(map[string]string)
+		}
+		secret.Annotations[k] = v
+	}
+	return &domain.SecretStatus{
+		Found:           true,
+		Checksum:        secret.Checksum,
+		ChecksumVersion: secret.ChecksumVersion,
+		Secret:          secret,
+	}, nil
+}
+
+// CreateSecret func writes a new manifest, it fails with domain.ErrConflict when it exists
+func (repo Repository) CreateSecret(ctx context.Context, secret *domain.Secret) error {
+	return repo.write(secret, true)
+}
+
+// UpdateSecret func writes the manifest
+func (repo Repository) UpdateSecret(ctx context.Context, secret *domain.Secret) error {
+	return repo.write(secret, false)
+}
+
+// DeleteSecret func removes the manifest, and its namespace directory when empty
+func (repo Repository) DeleteSecret(ctx context.Context, name string, namespace string) error {
+	file, err := repo.file(name, namespace)
+	if err != nil {
+		return err
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if err := os.Remove(file); err != nil {
+		if os.IsNotExist(err) {
+			return utils.ErrorHandler(domain.NewStatusError(404, ""))
+		}
+		return utils.ErrorHandler(err)
+	}
+	// it fails when the directory is not empty
+	os.Remove(filepath.Dir(file))
+	return repo.writeKustomization(file, false)
+}
+
+// write func renders the manifest and replaces the file at once
+func (repo Repository) write(secret *domain.Secret, create bool) error {
+	if secret.Encrypted != nil {
+		return utils.ErrorHandler(errors.New("file destination does not keep encrypted data, remove --encryptionKeyFile"))
+	}
+	file, err := repo.file(secret.Name, secret.Namespace)
+	if err != nil {
+		return err
+	}
+	manifest, err := render(secret)
+	if err != nil {
+		return err
+	}
+	content, err := yaml.Marshal(manifest)
+	if err != nil {
+		return utils.ErrorHandler(err)
+	}
+	repo.mu.Lock()
+	defer repo.mu.Unlock()
+	if create {
+		if _, err := os.Stat(file); err == nil {
+			return utils.ErrorHandler(domain.NewStatusError(409, ""))
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return utils.ErrorHandler(err)
+	}
+	if err := writeFile(file, content); err != nil {
+		return utils.ErrorHandler(err)
+	}
+	return repo.writeKustomization(file, true)
+}
+
+// file func returns Dir/NAMESPACE/NAME.yaml, refusing names that leave Dir
+func (repo Repository) file(name, namespace string) (string, error) {
+	for _, part := range []string{name, namespace} {
+		if part == "" || part == "." || part == ".." || strings.ContainsAny(part, `/\`) {
+			return "", utils.ErrorHandler(fmt.Errorf("invalid name or namespace %q for file destination", part))
+		}
+	}
+	return filepath.Join(repo.Dir, namespace, name+".yaml"), nil
+}
+
+// writeKustomization func adds or removes file in Dir/kustomization.yaml, when Kustomization is
+// set. The first call lists the manifests already written by this Repository in Dir, other YAML
+// files are left out, and later calls only update that list. mu must be held.
+func (repo Repository) writeKustomization(file string, present bool) error {
+	if !repo.Kustomization {
+		return nil
+	}
+	if repo.resources.files == nil {
+		files, err := repo.readResources()
+		if err != nil {
+			return err
+		}
+		repo.resources.files = files
+	}
+	relative, err := filepath.Rel(repo.Dir, file)
+	if err != nil {
+		return utils.ErrorHandler(err)
+	}
+	if present {
+		repo.resources.files[filepath.ToSlash(relative)] = true
+	} else {
+		delete(repo.resources.files, filepath.ToSlash(relative))
+	}
+	list := make([]string, 0, len(repo.resources.files))
+	for resource := range repo.resources.files {
+		list = append(list, resource)
+	}
+	sort.Strings(list)
+	content, err := yaml.Marshal(kustomization{APIVersion: "kustomize.config.k8s.io/v1beta1", Kind: "Kustomization", Resources: list})
+	if err != nil {
+		return utils.ErrorHandler(err)
+	}
+	if err := writeFile(filepath.Join(repo.Dir, kustomizationFile), content); err != nil {
+		return utils.ErrorHandler(err)
+	}
+	return nil
+}
+
+// readResources func returns the manifests in Dir written by this Repository, relative to Dir
+func (repo Repository) readResources() (map[string]bool, error) {
+	files, err := filepath.Glob(filepath.Join(repo.Dir, "*", "*.yaml"))
+	if err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
+	found := make(map[string]bool, len(files))
+	for _, file := range files {
+		if !written(file) {
+			continue
+		}
+		relative, err := filepath.Rel(repo.Dir, file)
+		if err != nil {
+			return nil, utils.ErrorHandler(err)
+		}
+		found[filepath.ToSlash(relative)] = true
+	}
+	return found, nil
+}
+
+// written func returns true when file is a Secret manifest with the checksum annotation, as
+// written by render
+func written(file string) bool {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return false
+	}
+	manifest := &secretManifest{}
+	if err := yaml.Unmarshal(content, manifest); err != nil {
+		return false
+	}
+	_, ok := manifest.Metadata.Annotations[domain.ChecksumAnnotation]
+	return manifest.APIVersion == "v1" && manifest.Kind == "Secret" && ok
+}
+
+// render func returns the kubernetes Secret for secret, with the checksum annotations
+func render(secret *domain.Secret) (*secretManifest, error) {
+	annotations := make(map[string]string, len(secret.Annotations)+2)
+	for k, v := range secret.Annotations {
+		annotations[k] = v
+	}
+	annotations[domain.ChecksumAnnotation] = secret.Checksum
+	if secret.ChecksumVersion != "" {
+		annotations[domain.ChecksumVersionAnnotation] = secret.ChecksumVersion
+	}
+	raw, err := secret.RawData()
+	if err != nil {
+		return nil, utils.ErrorHandler(fmt.Errorf("%w: %v", domain.ErrBadRequest, err))
+	}
+	data := make(map[string]string, len(raw))
+	for k, v := range raw {
+		data[k] = base64.StdEncoding.EncodeToString(v)
+	}
+	secretType := secret.Type
+	if secretType == "" {
+		secretType = "Opaque"
+	}
+	return &secretManifest{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata: manifestMetadata{
+			Name:        secret.Name,
+			Namespace:   secret.Namespace,
+			Labels:      secret.Labels,
+			Annotations: annotations,
+		},
+		Type:      secretType,
+		Immutable: secret.Immutable,
+		Data:      data,
+	}, nil
+}
+
+// writeFile func writes a temporary file in the same directory and renames it,
+// so readers never see a partial manifest
+func writeFile(file string, content []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
@@ -0,0 +1,171 @@
+package manifest
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepository(t *testing.T) {
+	dir := t.TempDir()
+	repo := newRepository(dir, true)
+	ctx := context.Background()
+
+	status, err := repo.GetSecret(ctx, "foo", "default")
+	assert.NoError(t, err)
+	assert.False(t, status.Found)
+
+	secret := &domain.Secret{
+		Name:            "foo",
+		Namespace:       "default",
+		Checksum:        "v2:abc",
+		ChecksumVersion: "v2",
+		Data:            map[string]string{"user": "admin"},
+		Labels:          map[string]string{"app": "foo"},
+		Annotations:     map[string]string{"team": "a"},
+	}
+	assert.NoError(t, repo.CreateSecret(ctx, secret))
+	err = repo.CreateSecret(ctx, secret)
+	assert.True(t, errors.Is(err, domain.ErrConflict))
+
+	file := filepath.Join(dir, "default", "foo.yaml")
+	info, err := os.Stat(file)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	content, err := ioutil.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "user: YWRtaW4=")
+	assert.Contains(t, string(content), domain.ChecksumAnnotation+": v2:abc")
+
+	status, err = repo.GetSecret(ctx, "foo", "default")
+	assert.NoError(t, err)
+	assert.True(t, status.Found)
+	assert.Equal(t, "v2:abc", status.Checksum)
+	assert.Equal(t, "v2", status.ChecksumVersion)
+	assert.Equal(t, secret.Data, status.Secret.Data)
+	assert.Equal(t, secret.Labels, status.Secret.Labels)
+	assert.Equal(t, secret.Annotations, status.Secret.Annotations)
+
+	secret.Checksum = "v2:def"
+	assert.NoError(t, repo.UpdateSecret(ctx, secret))
+	status, err = repo.GetSecret(ctx, "foo", "default")
+	assert.NoError(t, err)
+	assert.Equal(t, "v2:def", status.Checksum)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "default", "app.yaml"), []byte("apiVersion: v1\nkind: ConfigMap\n"), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "default", "other.yaml"), []byte("apiVersion: v1\nkind: Secret\nmetadata:\n  name: other\n"), 0600))
+	assert.NoError(t, repo.UpdateSecret(ctx, secret))
+	kustomization, err := ioutil.ReadFile(filepath.Join(dir, kustomizationFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(kustomization), "- default/foo.yaml")
+	assert.NotContains(t, string(kustomization), "app.yaml")
+	assert.NotContains(t, string(kustomization), "other.yaml")
+	assert.NoError(t, os.Remove(filepath.Join(dir, "default", "app.yaml")))
+	assert.NoError(t, os.Remove(filepath.Join(dir, "default", "other.yaml")))
+
+	assert.NoError(t, repo.DeleteSecret(ctx, "foo", "default"))
+	err = repo.DeleteSecret(ctx, "foo", "default")
+	assert.True(t, errors.Is(err, domain.ErrNotFound))
+	_, err = os.Stat(filepath.Join(dir, "default"))
+	assert.True(t, os.IsNotExist(err))
+	kustomization, err = ioutil.ReadFile(filepath.Join(dir, kustomizationFile))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(kustomization), "foo.yaml")
+}
+
+func TestRepositoryKustomizationPreviousRun(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	secret := &domain.Secret{Name: "foo", Namespace: "default", Checksum: "v2:abc", Data: map[string]string{"user": "admin"}}
+	assert.NoError(t, newRepository(dir, true).CreateSecret(ctx, secret))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "default", "app.yaml"), []byte("apiVersion: v1\nkind: ConfigMap\n"), 0600))
+
+	// a new run reads the manifests written before once, and only updates that list after
+	repo := newRepository(dir, true)
+	secret.Name = "bar"
+	assert.NoError(t, repo.CreateSecret(ctx, secret))
+	assert.NoError(t, os.Remove(filepath.Join(dir, "default", "foo.yaml")))
+	secret.Name = "baz"
+	assert.NoError(t, repo.CreateSecret(ctx, secret))
+	kustomization, err := ioutil.ReadFile(filepath.Join(dir, kustomizationFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(kustomization), "- default/bar.yaml\n- default/baz.yaml\n- default/foo.yaml\n")
+	assert.NotContains(t, string(kustomization), "app.yaml")
+
+	assert.NoError(t, repo.DeleteSecret(ctx, "bar", "default"))
+	kustomization, err = ioutil.ReadFile(filepath.Join(dir, kustomizationFile))
+	assert.NoError(t, err)
+	assert.Contains(t, string(kustomization), "- default/baz.yaml\n- default/foo.yaml\n")
+	assert.NotContains(t, string(kustomization), "bar.yaml")
+}
+
+func TestRepositoryTypeAndBinaryData(t *testing.T) {
+	repo := newRepository(t.TempDir(), false)
+	ctx := context.Background()
+	secret := &domain.Secret{
+		Name:       "tls",
+		Namespace:  "default",
+		Type:       "kubernetes.io/tls",
+		Immutable:  true,
+		Data:       map[string]string{"tls.crt": "cert"},
+		BinaryData: map[string]string{"keystore": "/wD+"},
+	}
+	assert.NoError(t, repo.CreateSecret(ctx, secret))
+	content, err := ioutil.ReadFile(filepath.Join(repo.Dir, "default", "tls.yaml"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "type: kubernetes.io/tls\nimmutable: true\n")
+	assert.Contains(t, string(content), "keystore: /wD+")
+
+	status, err := repo.GetSecret(ctx, "tls", "default")
+	assert.NoError(t, err)
+	assert.Equal(t, secret.Type, status.Secret.Type)
+	assert.True(t, status.Secret.Immutable)
+	assert.Equal(t, secret.Data, status.Secret.Data)
+	assert.Equal(t, secret.BinaryData, status.Secret.BinaryData)
+}
+
+func TestRepositoryErrors(t *testing.T) {
+	repo := newRepository(t.TempDir(), false)
+	ctx := context.Background()
+
+	_, err := repo.GetSecret(ctx, "../foo", "default")
+	assert.Error(t, err)
+	err = repo.UpdateSecret(ctx, &domain.Secret{Name: "foo", Namespace: ".."})
+	assert.Error(t, err)
+	err = repo.UpdateSecret(ctx, &domain.Secret{Name: "foo", Namespace: "default", Encrypted: &domain.EncryptedData{}})
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(repo.Dir, kustomizationFile))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestNewRepository(t *testing.T) {
+	destination, _ := url.Parse("file:///tmp/secrets/")
+	repo, err := NewRepository(destination)
+	assert.NoError(t, err)
+	assert.Equal(t, "/tmp/secrets", repo.Dir)
+
+	destination, _ = url.Parse("file:secrets/cluster-a")
+	repo, err = NewRepository(destination)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join("secrets", "cluster-a"), repo.Dir)
+
+	destination, _ = url.Parse("file:./secrets")
+	repo, err = NewRepository(destination)
+	assert.NoError(t, err)
+	assert.Equal(t, "secrets", repo.Dir)
+
+	destination, _ = url.Parse("file://secrets")
+	_, err = NewRepository(destination)
+	assert.EqualError(t, err, "[ERROR]: file destination cannot have a host, use file:///secrets for an absolute path or file:secrets for a relative one")
+
+	destination, _ = url.Parse("file://")
+	_, err = NewRepository(destination)
+	assert.Error(t, err)
+}
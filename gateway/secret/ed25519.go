@@ -0,0 +1,76 @@
+package gateway
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/betorvs/secretpublisher/utils"
+)
+
+// Ed25519Key signs requests with a private key, Secret Receiver only needs the public key.
+// The signature starts with ed25519= followed by the base64 signature.
+type Ed25519Key struct {
+	ID  string
+	Key ed25519.PrivateKey
+}
+
+func (k *Ed25519Key) keyID() string {
+	return k.ID
+}
+
+func (k *Ed25519Key) sign(timestamp, message string) string {
+	return "ed25519=" + base64.StdEncoding.EncodeToString(ed25519.Sign(k.Key, []byte(message)))
+}
+
+// LoadEd25519Key func reads a PKCS #8 PEM private key from file. Without id,
+// the key id is the utils.KeyFingerprint of the public key.
+func LoadEd25519Key(file, id string) (*Ed25519Key, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s has no PEM PRIVATE KEY", file)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %s: %v", file, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an Ed25519 key", file)
+	}
+	if id == "" {
+		id = utils.KeyFingerprint(key.Public().(ed25519.PublicKey))
+	}
+	return &Ed25519Key{ID: id, Key: key}, nil
+}
+
+// GenerateEd25519Key func returns a new private key in PKCS #8 and its public key in PKIX,
+// with the utils.KeyFingerprint as key id
+func GenerateEd25519Key() (*domain.KeyPair, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.KeyPair{
+		ID:         utils.KeyFingerprint(public),
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})),
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+	}, nil
+}
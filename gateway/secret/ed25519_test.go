@@ -0,0 +1,57 @@
+package gateway
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEd25519Key(t *testing.T) {
+	pair, err := GenerateEd25519Key()
+	assert.NoError(t, err)
+	assert.Len(t, pair.ID, 16)
+	assert.Contains(t, pair.PublicKey, "BEGIN PUBLIC KEY")
+
+	file, err := ioutil.TempFile("", "publisher-*.key")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(pair.PrivateKey)
+	assert.NoError(t, err)
+	file.Close()
+
+	key, err := LoadEd25519Key(file.Name(), "")
+	assert.NoError(t, err)
+	assert.Equal(t, pair.ID, key.ID)
+	key, err = LoadEd25519Key(file.Name(), "cluster-a")
+	assert.NoError(t, err)
+
+	repo := Repository{PrivateKey: key}
+	s, err := repo.signer(time.Now())
+	assert.NoError(t, err)
+	req, _ := http.NewRequest("DELETE", "http://localhost/default/foo", nil)
+	signRequest(req, s, "foo", "default", nil, time.Unix(1580475458, 0))
+	assert.Equal(t, "cluster-a", req.Header.Get("X-SECRET-Key-ID"))
+	signature := req.Header.Get("X-SECRET-Signature")
+	assert.True(t, strings.HasPrefix(signature, "ed25519="))
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(signature, "ed25519="))
+	assert.NoError(t, err)
+	public := key.Key.Public().(ed25519.PublicKey)
+	assert.True(t, ed25519.Verify(public, []byte("v1:1580475458:foo"), decoded))
+	assert.False(t, ed25519.Verify(public, []byte("v1:1580475458:bar"), decoded))
+	// v2 is signed even with signingVersion v1
+	assert.Equal(t, "v2", req.Header.Get("X-SECRET-Signature-Version"))
+	decoded, err = base64.StdEncoding.DecodeString(strings.TrimPrefix(req.Header.Get("X-SECRET-Signature-V2"), "ed25519="))
+	assert.NoError(t, err)
+	message := v2BaseString("1580475458", req.Header.Get("X-SECRET-Nonce"), "DELETE", "/default/foo", "default", bodySHA256(nil))
+	assert.True(t, ed25519.Verify(public, []byte(message), decoded))
+
+	_, err = LoadEd25519Key(file.Name()+".missing", "")
+	assert.Error(t, err)
+}
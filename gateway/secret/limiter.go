@@ -0,0 +1,31 @@
+package gateway
+
+import (
+	"context"
+)
+
+// limiter struct is a semaphore for requests to Secret Receiver at the same time
+type limiter struct {
+	slots chan struct{}
+}
+
+// newLimiter func returns nil, meaning no limit, when size is zero
+func newLimiter(size int) *limiter {
+	if size <= 0 {
+		return nil
+	}
+	return &limiter{slots: make(chan struct{}, size)}
+}
+
+// acquire func waits for a free slot and returns the func to release it
+func (l *limiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.slots <- struct{}{}:
+		return func() { <-l.slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
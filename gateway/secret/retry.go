@@ -0,0 +1,132 @@
+package gateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+)
+
+// RetryCounter struct counts retried requests from many goroutines
+type RetryCounter struct {
+	count int64
+}
+
+// Add func
+func (c *RetryCounter) Add() {
+	atomic.AddInt64(&c.count, 1)
+}
+
+// Count func
+func (c *RetryCounter) Count() int64 {
+	return atomic.LoadInt64(&c.count)
+}
+
+// retryable func returns true for timeouts, connection errors, 429 and 5xx (but 501) when the
+// method is idempotent. POST is retried only with an Idempotency-Key. Cancelled requests and
+// other errors, like TLS or signing errors, are not retried.
+func retryable(method, idempotencyKey string, err error) bool {
+	if method == "POST" && idempotencyKey == "" {
+		return false
+	}
+	var statusError *domain.StatusError
+	if !errors.As(err, &statusError) {
+		return connectionError(err)
+	}
+	switch {
+	case statusError.StatusCode == http.StatusTooManyRequests:
+		return true
+	case statusError.StatusCode == http.StatusNotImplemented:
+		return false
+	}
+	return statusError.StatusCode >= 500
+}
+
+// connectionError func returns true for timeouts, connections refused or reset and connections
+// closed by the server before the response
+func connectionError(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return true
+	}
+	var opError *net.OpError
+	if errors.As(err, &opError) {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// backoff func returns the wait before the next attempt: the Retry-After header when
+// present, or config.RetryWait doubled each attempt with jitter, up to config.RetryMaxWait
+func backoff(attempt int, retryAfter string) time.Duration {
+	if wait, ok := parseRetryAfter(retryAfter, time.Now()); ok {
+		if config.RetryMaxWait > 0 && wait > config.RetryMaxWait {
+			return config.RetryMaxWait
+		}
+		return wait
+	}
+	wait := config.RetryWait
+	for i := 0; i < attempt && (config.RetryMaxWait == 0 || wait < config.RetryMaxWait); i++ {
+		wait *= 2
+	}
+	if config.RetryMaxWait > 0 && wait > config.RetryMaxWait {
+		wait = config.RetryMaxWait
+	}
+	if wait <= 1 {
+		return wait
+	}
+	// equal jitter: half fixed, half random
+	half := wait / 2
+	return half + randomDuration(wait-half)
+}
+
+// parseRetryAfter func reads Retry-After as seconds or HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := date.Sub(now)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// randomDuration func returns a random duration in [0, max)
+func randomDuration(max time.Duration) time.Duration {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max)))
+	if err != nil {
+		return 0
+	}
+	return time.Duration(n.Int64())
+}
+
+// newIdempotencyKey func returns a random key sent in every attempt of one POST
+func newIdempotencyKey() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,100 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryable(t *testing.T) {
+	assert.True(t, retryable("GET", "", &url.Error{Op: "Get", URL: "http://localhost", Err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}}))
+	assert.True(t, retryable("GET", "", &url.Error{Op: "Get", URL: "http://localhost", Err: io.EOF}))
+	assert.True(t, retryable("GET", "", &url.Error{Op: "Get", URL: "http://localhost", Err: timeoutError{}}))
+	assert.False(t, retryable("GET", "", &url.Error{Op: "Get", URL: "http://localhost", Err: context.Canceled}))
+	assert.False(t, retryable("GET", "", errors.New("no valid signing key in keyring")))
+	assert.False(t, retryable("GET", "", &url.Error{Op: "Get", URL: "https://localhost", Err: errors.New("x509: certificate signed by unknown authority")}))
+	assert.True(t, retryable("PUT", "", domain.NewStatusError(503, "")))
+	assert.True(t, retryable("DELETE", "", domain.NewStatusError(429, "")))
+	assert.False(t, retryable("GET", "", domain.NewStatusError(501, "")))
+	assert.False(t, retryable("GET", "", domain.NewStatusError(400, "")))
+	assert.False(t, retryable("POST", "", domain.NewStatusError(503, "")))
+	assert.True(t, retryable("POST", "key", domain.NewStatusError(503, "")))
+}
+
+// timeoutError is a net.Error like the client timeout
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestBackoff(t *testing.T) {
+	config.RetryWait = 100 * time.Millisecond
+	config.RetryMaxWait = time.Second
+	for attempt := 0; attempt < 6; attempt++ {
+		wait := backoff(attempt, "")
+		assert.LessOrEqual(t, wait, time.Second)
+		assert.GreaterOrEqual(t, wait, 50*time.Millisecond)
+	}
+	assert.Equal(t, time.Second, backoff(0, "120"))
+	assert.Equal(t, 0*time.Second, backoff(0, "0"))
+	wait, ok := parseRetryAfter("Wed, 21 Oct 2015 07:28:10 GMT", time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC))
+	assert.True(t, ok)
+	assert.Equal(t, 10*time.Second, wait)
+	_, ok = parseRetryAfter("soon", time.Now())
+	assert.False(t, ok)
+}
+
+func TestRepositoryRetries(t *testing.T) {
+	var calls int
+	var keys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		if calls < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+	config.ReceiverURL = server.URL
+	config.EncodingRequest = "disabled"
+	config.Retries = 3
+	config.RetryWait = time.Millisecond
+	defer func() { config.Retries = 0; config.RetryPost = false }()
+	repo := Repository{Client: server.Client(), Retries: &RetryCounter{}}
+	ctx := context.Background()
+
+	err := repo.UpdateSecret(ctx, &domain.Secret{Name: "foo", Namespace: "default"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, int64(2), repo.RetryCount())
+
+	// POST without idempotency key is not retried
+	calls = 0
+	err = repo.CreateSecret(ctx, &domain.Secret{Name: "foo", Namespace: "default"})
+	assert.True(t, errors.Is(err, domain.ErrServer))
+	assert.Equal(t, 1, calls)
+
+	calls = 0
+	keys = nil
+	config.RetryPost = true
+	err = repo.CreateSecret(ctx, &domain.Secret{Name: "foo", Namespace: "default"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.NotEmpty(t, keys[0])
+	assert.Equal(t, keys[0], keys[2])
+}
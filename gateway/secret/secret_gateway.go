@@ -2,150 +2,259 @@ package gateway
 
 import (
 	"bytes"
+	"context"
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 
-	"github.com/betorvs/secretpublisher/appcontext"
 	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
 	"github.com/betorvs/secretpublisher/utils"
 )
 
 // Repository struct
 type Repository struct {
 	Client *http.Client
+	// URL is the Secret Receiver URL, config.ReceiverURL when empty
+	URL string
+	// Retries counts retried requests, it can be nil
+	Retries *RetryCounter
+	// Keyring has the signing keys, when nil config.EncodingRequest is the key
+	Keyring *domain.Keyring
+	// PrivateKey signs with Ed25519 instead of HMAC when it is not nil
+	PrivateKey *Ed25519Key
+	// EncodingRequest is the HMAC key without keyring, config.EncodingRequest when empty
+	EncodingRequest string
+	// inFlight limits requests at the same time, it can be nil
+	inFlight *limiter
 }
 
-// GetSecretByName func
-func (repo Repository) GetSecretByName(secret string, namespace string) (string, error) {
-	url := fmt.Sprintf("%s/%s/%s", config.ReceiverURL, namespace, secret)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", utils.ErrorHandler(err)
-	}
-	if config.EncodingRequest != "disabled" {
-		now := time.Now()
-		timestamp := fmt.Sprintf("%v", now.Unix())
-		req.Header.Add("X-SECRET-Request-Timestamp", timestamp)
-		basestring := fmt.Sprintf("v1:%s:%s", timestamp, secret)
-		signature := createHeaderSignature(timestamp, basestring, config.EncodingRequest)
-		req.Header.Add("X-SECRET-Signature", signature)
+// RetryCount func returns how many requests were retried
+func (repo Repository) RetryCount() int64 {
+	if repo.Retries == nil {
+		return 0
 	}
-	resp, err := repo.Client.Do(req)
-	if err != nil {
-		return "", utils.ErrorHandler(err)
+	return repo.Retries.Count()
+}
+
+// baseURL func returns URL or config.ReceiverURL
+func (repo Repository) baseURL() string {
+	if repo.URL != "" {
+		return repo.URL
 	}
-	bodyText, err := ioutil.ReadAll(resp.Body)
+	return config.ReceiverURL
+}
+
+// GetSecret func
+func (repo Repository) GetSecret(ctx context.Context, name string, namespace string) (*domain.SecretStatus, error) {
+	url := fmt.Sprintf("%s/%s/%s", repo.baseURL(), namespace, name)
+	bodyText, err := repo.do(ctx, "GET", url, name, namespace, nil)
 	if err != nil {
-		return "", utils.ErrorHandler(err)
-	}
-	if resp.StatusCode == 204 {
-		return "notFound", nil
+		if se, ok := err.(*domain.StatusError); ok && se.StatusCode == http.StatusNotFound {
+			return &domain.SecretStatus{Found: false}, nil
+		}
+		return nil, err
 	}
-	res := fmt.Sprintln(string(bodyText))
-	if config.Debug {
-		fmt.Printf("[SECRETRECEIVER] Response Code: %s, Body Response: %s \n", resp.Status, res)
+	if bodyText == nil {
+		return &domain.SecretStatus{Found: false}, nil
 	}
-	if resp.StatusCode >= 400 {
-		errLocal := fmt.Errorf("%s", resp.Status)
-		return "", errLocal
-	}
-	defer resp.Body.Close()
-	return res, nil
+	return parseSecretStatus(bodyText), nil
+}
+
+// CreateSecret func
+func (repo Repository) CreateSecret(ctx context.Context, secret *domain.Secret) error {
+	return repo.send(ctx, "POST", secret)
+}
+
+// UpdateSecret func
+func (repo Repository) UpdateSecret(ctx context.Context, secret *domain.Secret) error {
+	return repo.send(ctx, "PUT", secret)
+}
+
+// DeleteSecret func
+func (repo Repository) DeleteSecret(ctx context.Context, name string, namespace string) error {
+	url := fmt.Sprintf("%s/%s/%s", repo.baseURL(), namespace, name)
+	_, err := repo.do(ctx, "DELETE", url, name, namespace, nil)
+	return err
 }
 
-// PostOrPUTSecret func
-func (repo Repository) PostOrPUTSecret(method string, secret string, body []byte) error {
-	url := config.ReceiverURL
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+// send func posts or puts a secret in Secret Receiver
+func (repo Repository) send(ctx context.Context, method string, secret *domain.Secret) error {
+	body, err := json.Marshal(secret)
 	if err != nil {
 		return utils.ErrorHandler(err)
 	}
-	if config.EncodingRequest != "disabled" {
-		now := time.Now()
-		timestamp := fmt.Sprintf("%v", now.Unix())
-		req.Header.Add("X-SECRET-Request-Timestamp", timestamp)
-		basestring := fmt.Sprintf("v1:%s:%s", timestamp, secret)
-		signature := createHeaderSignature(timestamp, basestring, config.EncodingRequest)
-		req.Header.Add("X-SECRET-Signature", signature)
+	_, err = repo.do(ctx, method, repo.baseURL(), secret.Name, secret.Namespace, body)
+	return err
+}
+
+// do func sends a signed request and returns the response body.
+// It returns nil body for 204 No Content and a domain.StatusError for any status above 204.
+// Idempotent requests are retried, see retryable.
+func (repo Repository) do(ctx context.Context, method, url, secretName, namespace string, body []byte) ([]byte, error) {
+	var idempotencyKey string
+	if method == "POST" && config.RetryPost {
+		idempotencyKey = newIdempotencyKey()
 	}
-	req.Header.Set("Content-Type", "application/json")
-	resp, err := repo.Client.Do(req)
+	for attempt := 0; ; attempt++ {
+		bodyText, retryAfter, err := repo.try(ctx, method, url, secretName, namespace, body, idempotencyKey)
+		if err == nil || ctx.Err() != nil || attempt >= config.Retries || !retryable(method, idempotencyKey, err) {
+			return bodyText, err
+		}
+		wait := backoff(attempt, retryAfter)
+		if config.Debug {
+			fmt.Fprintf(utils.Out(), "[SECRETRECEIVER] Retry %d/%d for %s %s in %s: %v \n", attempt+1, config.Retries, method, secretName, wait, err)
+		}
+		if repo.Retries != nil {
+			repo.Retries.Add()
+		}
+		select {
+		case <-ctx.Done():
+			return nil, utils.ErrorHandler(ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
+
+// try func sends one request and returns the body, the Retry-After header and the error
+func (repo Repository) try(ctx context.Context, method, url, secretName, namespace string, body []byte, idempotencyKey string) ([]byte, string, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewBuffer(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
 	if err != nil {
-		return utils.ErrorHandler(err)
+		return nil, "", utils.ErrorHandler(err)
 	}
-	bodyText, err := ioutil.ReadAll(resp.Body)
+	requestSigner, err := repo.signer(time.Now())
 	if err != nil {
-		fmt.Printf("[ERROR] %s", err)
-		return err
+		return nil, "", utils.ErrorHandler(err)
 	}
-	if config.Debug {
-		s := string(bodyText)
-		fmt.Printf("[SECRETRECEIVER] Response Code: %s, Body Response: %s \n", resp.Status, s)
+	if requestSigner != nil {
+		signRequest(req, requestSigner, secretName, namespace, body, time.Now())
 	}
-	if resp.StatusCode > 204 {
-		errLocal := fmt.Errorf("%s", resp.Status)
-		return errLocal
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
 	}
-	defer resp.Body.Close()
-	return nil
-}
-
-// DeleteSecretK8S func
-func (repo Repository) DeleteSecretK8S(secret string, namespace string) error {
-	url := fmt.Sprintf("%s/%s/%s", config.ReceiverURL, namespace, secret)
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		return utils.ErrorHandler(err)
+	if body != nil || method == "DELETE" {
+		req.Header.Set("Content-Type", "application/json")
 	}
-	if config.EncodingRequest != "disabled" {
-		now := time.Now()
-		timestamp := fmt.Sprintf("%v", now.Unix())
-		req.Header.Add("X-SECRET-Request-Timestamp", timestamp)
-		basestring := fmt.Sprintf("v1:%s:%s", timestamp, secret)
-		signature := createHeaderSignature(timestamp, basestring, config.EncodingRequest)
-		req.Header.Add("X-SECRET-Signature", signature)
+	release, err := repo.inFlight.acquire(ctx)
+	if err != nil {
+		return nil, "", utils.ErrorHandler(err)
 	}
-	req.Header.Set("Content-Type", "application/json")
+	defer release()
 	resp, err := repo.Client.Do(req)
 	if err != nil {
-		return utils.ErrorHandler(err)
+		return nil, "", utils.ErrorHandler(err)
+	}
+	defer resp.Body.Close()
+	bodyText, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", utils.ErrorHandler(err)
 	}
 	if config.Debug {
-		fmt.Printf("[SECRETRECEIVER] Response: %s \n", resp.Status)
+		fmt.Fprintf(utils.Out(), "[SECRETRECEIVER] Response Code: %s, Body Response: %s \n", resp.Status, string(bodyText))
 	}
 	if resp.StatusCode > 204 {
-		errLocal := fmt.Errorf("%s", resp.Status)
-		return errLocal
+		return nil, resp.Header.Get("Retry-After"), domain.NewStatusError(resp.StatusCode, resp.Status)
 	}
-	defer resp.Body.Close()
-	return nil
+	if resp.StatusCode == 204 {
+		return nil, "", nil
+	}
+	return bodyText, "", nil
+}
+
+// parseSecretStatus func reads the GET response, that is the checksum as a JSON
+// string or, in newer Secret Receivers, the whole secret as a JSON object
+func parseSecretStatus(bodyText []byte) *domain.SecretStatus {
+	status := &domain.SecretStatus{Found: true}
+	trimmed := strings.TrimSpace(string(bodyText))
+	if strings.HasPrefix(trimmed, "{") {
+		secret := &domain.Secret{}
+		if err := json.Unmarshal([]byte(trimmed), secret); err == nil {
+			status.Secret = secret
+			status.Checksum = utils.RemoveQuotes(secret.Checksum)
+			status.ChecksumVersion = secret.ChecksumVersion
+			return status
+		}
+	}
+	status.Checksum = utils.RemoveQuotes(trimmed)
+	return status
 }
 
 // createHeaderSignature
 func createHeaderSignature(timestamp string, message string, secret string) string {
 	mac := hmac.New(sha256.New, []byte(secret))
 	if _, err := mac.Write([]byte(message)); err != nil {
-		fmt.Printf("mac.Write(%v) failed\n", message)
+		fmt.Fprintf(utils.Out(), "mac.Write(%v) failed\n", message)
 		return ""
 	}
 	calculatedMAC := "v0=" + hex.EncodeToString(mac.Sum(nil))
 	return calculatedMAC
 }
 
-func init() {
-	if config.TestRun == "true" {
-		return
+// NewRepository func creates a Repository for receiverURL from the configuration, after flags are parsed.
+// Requests are signed with the Ed25519 key in config.PrivateKeyFile with --signingMode ed25519,
+// with the active key in keyring, or with config.EncodingRequest when it is nil.
+func NewRepository(receiverURL string, keyring *domain.Keyring) (Repository, error) {
+	return NewReceiverRepository(&domain.Receiver{URL: receiverURL}, keyring)
+}
+
+// NewReceiverRepository func creates a Repository for one receiver, its empty fields use the flags
+// like NewRepository
+func NewReceiverRepository(receiver *domain.Receiver, keyring *domain.Keyring) (Repository, error) {
+	client, err := newHTTPClient(receiver.TLS)
+	if err != nil {
+		return Repository{}, err
+	}
+	repo := Repository{
+		Client:          client,
+		URL:             receiver.URL,
+		Retries:         &RetryCounter{},
+		Keyring:         keyring,
+		EncodingRequest: receiver.EncodingRequest,
+		inFlight:        newLimiter(config.MaxInFlight),
+	}
+	signingMode, privateKeyFile, keyID := receiver.SigningMode, receiver.PrivateKeyFile, receiver.KeyID
+	if signingMode == "" {
+		signingMode = config.SigningMode
 	}
-	client := http.Client{
-		Timeout: time.Second * config.PublisherTimeout,
+	if privateKeyFile == "" {
+		privateKeyFile = config.PrivateKeyFile
 	}
-	appcontext.Current.Add(appcontext.Repository, Repository{Client: &client})
-	if appcontext.Current.Count() != 0 && config.Debug {
-		fmt.Println("[INFO] Using Repository")
+	if keyID == "" {
+		keyID = config.KeyID
+	}
+	if signingMode == "ed25519" {
+		repo.PrivateKey, err = LoadEd25519Key(privateKeyFile, keyID)
+		if err != nil {
+			return Repository{}, utils.ErrorHandler(err)
+		}
+	}
+	return repo, nil
+}
+
+// NewHTTPClient func returns a client with config.PublisherTimeout and the TLS flags, also used by other backends
+func NewHTTPClient() (*http.Client, error) {
+	return newHTTPClient(nil)
+}
+
+// newHTTPClient func returns a client with config.PublisherTimeout and the TLS flags replaced by tlsOverride
+func newHTTPClient(tlsOverride *domain.ReceiverTLS) (*http.Client, error) {
+	transport, err := newTransport(tlsOverride)
+	if err != nil {
+		return nil, utils.ErrorHandler(err)
 	}
+	return &http.Client{
+		Timeout:   config.PublisherTimeout,
+		Transport: transport,
+	}, nil
 }
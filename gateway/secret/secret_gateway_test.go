@@ -1,8 +1,15 @@
 package gateway
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -13,3 +20,49 @@ func TestCreateHeaderSignature(t *testing.T) {
 	test := createHeaderSignature(timestamp, bodyString, longString)
 	assert.Contains(t, test, "v0=dd8c5752a")
 }
+
+func TestParseSecretStatus(t *testing.T) {
+	test := parseSecretStatus([]byte("\"abc\"\n"))
+	assert.True(t, test.Found)
+	assert.Equal(t, "abc", test.Checksum)
+	assert.Nil(t, test.Secret)
+	test = parseSecretStatus([]byte(`{"name":"foo","checksum":"v2:abc","checksumVersion":"v2","data":{"user":"admin"}}`))
+	assert.Equal(t, "v2:abc", test.Checksum)
+	assert.Equal(t, "v2", test.ChecksumVersion)
+	assert.Equal(t, "admin", test.Secret.Data["user"])
+}
+
+func TestRepositoryStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/default/missing":
+			w.WriteHeader(http.StatusNoContent)
+		case "/default/foo":
+			fmt.Fprintln(w, "\"abc\"")
+		case "/default/locked":
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+	config.ReceiverURL = server.URL
+	config.EncodingRequest = "disabled"
+	repo := Repository{Client: server.Client()}
+	ctx := context.Background()
+	status, err := repo.GetSecret(ctx, "missing", "default")
+	assert.NoError(t, err)
+	assert.False(t, status.Found)
+	status, err = repo.GetSecret(ctx, "foo", "default")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", status.Checksum)
+	_, err = repo.GetSecret(ctx, "locked", "default")
+	assert.True(t, errors.Is(err, domain.ErrUnauthorized))
+	err = repo.DeleteSecret(ctx, "other", "default")
+	assert.True(t, errors.Is(err, domain.ErrServer))
+	var statusError *domain.StatusError
+	assert.True(t, errors.As(err, &statusError))
+	assert.Equal(t, http.StatusInternalServerError, statusError.StatusCode)
+	err = repo.CreateSecret(ctx, &domain.Secret{Name: "foo", Namespace: "default"})
+	assert.True(t, errors.Is(err, domain.ErrServer))
+}
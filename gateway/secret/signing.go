@@ -0,0 +1,107 @@
+package gateway
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+)
+
+// signingV2 signs timestamp, nonce, method, path, namespace and body hash
+const signingV2 = "v2"
+
+// signer signs the messages in signRequest, with a shared HMAC key or an Ed25519 private key
+type signer interface {
+	// keyID is sent in X-SECRET-Key-ID when not empty
+	keyID() string
+	sign(timestamp, message string) string
+}
+
+// hmacSigner signs with HMAC-SHA256, the signature starts with v0=
+type hmacSigner struct {
+	key *domain.SigningKey
+}
+
+func (s hmacSigner) keyID() string {
+	return s.key.ID
+}
+
+func (s hmacSigner) sign(timestamp, message string) string {
+	return createHeaderSignature(timestamp, message, s.key.Secret)
+}
+
+// signer func returns the Ed25519 signer when PrivateKey is set, the active key in the keyring,
+// or EncodingRequest without keyring. It returns nil when requests are not signed.
+func (repo Repository) signer(now time.Time) (signer, error) {
+	if repo.PrivateKey != nil {
+		return repo.PrivateKey, nil
+	}
+	if repo.Keyring != nil {
+		key := repo.Keyring.Active(now)
+		if key == nil {
+			return nil, errors.New("no valid signing key in keyring")
+		}
+		return hmacSigner{key: key}, nil
+	}
+	key := repo.EncodingRequest
+	if key == "" {
+		key = config.EncodingRequest
+	}
+	if key == "" || key == "disabled" {
+		return nil, nil
+	}
+	return hmacSigner{key: &domain.SigningKey{Secret: key}}, nil
+}
+
+// signRequest func adds the signature headers signed by s, and X-SECRET-Key-ID when s has a key id.
+// X-SECRET-Signature with v1 is always sent, so receivers without v2 keep working.
+// With config.SigningVersion v2, or an Ed25519 signer, it also sends X-SECRET-Signature-Version, X-SECRET-Nonce,
+// X-SECRET-Content-SHA256 and X-SECRET-Signature-V2 over v2BaseString.
+func signRequest(req *http.Request, s signer, secretName, namespace string, body []byte, now time.Time) {
+	timestamp := fmt.Sprintf("%v", now.Unix())
+	req.Header.Add("X-SECRET-Request-Timestamp", timestamp)
+	if id := s.keyID(); id != "" {
+		req.Header.Set("X-SECRET-Key-ID", id)
+	}
+	basestring := fmt.Sprintf("v1:%s:%s", timestamp, secretName)
+	req.Header.Add("X-SECRET-Signature", s.sign(timestamp, basestring))
+	// anyone with the public key can check an Ed25519 signature of v1, without the body,
+	// and replay it with another body, so Ed25519 always signs v2 too
+	if _, ed := s.(*Ed25519Key); config.SigningVersion != signingV2 && !ed {
+		return
+	}
+	nonce := newNonce()
+	bodyHash := bodySHA256(body)
+	req.Header.Set("X-SECRET-Signature-Version", signingV2)
+	req.Header.Set("X-SECRET-Nonce", nonce)
+	req.Header.Set("X-SECRET-Content-SHA256", bodyHash)
+	basestring = v2BaseString(timestamp, nonce, req.Method, req.URL.EscapedPath(), namespace, bodyHash)
+	req.Header.Set("X-SECRET-Signature-V2", s.sign(timestamp, basestring))
+}
+
+// v2BaseString func returns the message signed in v2, one field per line:
+// v2, timestamp, nonce, method, path, namespace and the hex SHA-256 of the body
+func v2BaseString(timestamp, nonce, method, path, namespace, bodyHash string) string {
+	return fmt.Sprintf("v2\n%s\n%s\n%s\n%s\n%s\n%s", timestamp, nonce, method, path, namespace, bodyHash)
+}
+
+// bodySHA256 func returns the hex SHA-256 of body, for no body it is the hash of nothing
+func bodySHA256(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// newNonce func returns a random value, a new one for every attempt
+func newNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,74 @@
+package gateway
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignRequest(t *testing.T) {
+	key := &domain.SigningKey{Secret: "2aeccc9c03b36fea59ebec69"}
+	hmacKey := hmacSigner{key: key}
+	now := time.Unix(1580475458, 0)
+
+	req, _ := http.NewRequest("POST", "http://localhost/secret", nil)
+	signRequest(req, hmacKey, "foo", "default", []byte(`{"name":"foo"}`), now)
+	assert.Equal(t, "1580475458", req.Header.Get("X-SECRET-Request-Timestamp"))
+	assert.Equal(t, createHeaderSignature("1580475458", "v1:1580475458:foo", key.Secret), req.Header.Get("X-SECRET-Signature"))
+	assert.Empty(t, req.Header.Get("X-SECRET-Signature-V2"))
+	assert.Empty(t, req.Header.Get("X-SECRET-Key-ID"))
+
+	config.SigningVersion = "v2"
+	defer func() { config.SigningVersion = "" }()
+	req, _ = http.NewRequest("POST", "http://localhost/secret", nil)
+	signRequest(req, hmacKey, "foo", "default", []byte(`{"name":"foo"}`), now)
+	assert.NotEmpty(t, req.Header.Get("X-SECRET-Signature"))
+	assert.Equal(t, "v2", req.Header.Get("X-SECRET-Signature-Version"))
+	assert.Equal(t, bodySHA256([]byte(`{"name":"foo"}`)), req.Header.Get("X-SECRET-Content-SHA256"))
+	nonce := req.Header.Get("X-SECRET-Nonce")
+	assert.Len(t, nonce, 32)
+	base := v2BaseString("1580475458", nonce, "POST", "/secret", "default", bodySHA256([]byte(`{"name":"foo"}`)))
+	assert.Equal(t, createHeaderSignature("1580475458", base, key.Secret), req.Header.Get("X-SECRET-Signature-V2"))
+
+	other, _ := http.NewRequest("POST", "http://localhost/secret", nil)
+	signRequest(other, hmacKey, "foo", "default", []byte(`{"name":"foo"}`), now)
+	assert.NotEqual(t, nonce, other.Header.Get("X-SECRET-Nonce"))
+
+	// a different body or namespace does not match the captured signature
+	changed := v2BaseString("1580475458", nonce, "POST", "/secret", "other", bodySHA256([]byte(`{"name":"bar"}`)))
+	assert.NotEqual(t, req.Header.Get("X-SECRET-Signature-V2"), createHeaderSignature("1580475458", changed, key.Secret))
+}
+
+func TestSigner(t *testing.T) {
+	now := time.Now()
+	config.EncodingRequest = "disabled"
+	s, err := Repository{}.signer(now)
+	assert.NoError(t, err)
+	assert.Nil(t, s)
+
+	config.EncodingRequest = "shared"
+	defer func() { config.EncodingRequest = "" }()
+	s, err = Repository{}.signer(now)
+	assert.NoError(t, err)
+	assert.Equal(t, createHeaderSignature("1", "message", "shared"), s.sign("1", "message"))
+	s, err = Repository{EncodingRequest: "receiver"}.signer(now)
+	assert.NoError(t, err)
+	assert.Equal(t, createHeaderSignature("1", "message", "receiver"), s.sign("1", "message"))
+
+	expired := now.Add(-time.Hour)
+	keyring := &domain.Keyring{Keys: []*domain.SigningKey{{ID: "old", Secret: "a", NotAfter: &expired}}}
+	_, err = Repository{Keyring: keyring}.signer(now)
+	assert.Error(t, err)
+
+	keyring.Keys = append(keyring.Keys, &domain.SigningKey{ID: "new", Secret: "b"})
+	s, err = Repository{Keyring: keyring}.signer(now)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", s.keyID())
+	req, _ := http.NewRequest("GET", "http://localhost/default/foo", nil)
+	signRequest(req, s, "foo", "default", nil, now)
+	assert.Equal(t, "new", req.Header.Get("X-SECRET-Key-ID"))
+}
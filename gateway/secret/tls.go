@@ -0,0 +1,172 @@
+package gateway
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/betorvs/secretpublisher/utils"
+)
+
+// tlsVersions are the values accepted by --tlsMinVersion
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// newTransport func returns an http.Transport with the TLS configuration from flags,
+// replaced by the fields set in override
+func newTransport(override *domain.ReceiverTLS) (*http.Transport, error) {
+	tlsConfig, err := newTLSConfig(override)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// tlsSettings func returns the TLS flags, replaced by the fields set in override
+func tlsSettings(override *domain.ReceiverTLS) domain.ReceiverTLS {
+	settings := domain.ReceiverTLS{
+		CAFile:     config.TLSCAFile,
+		CertFile:   config.TLSCertFile,
+		KeyFile:    config.TLSKeyFile,
+		MinVersion: config.TLSMinVersion,
+		ServerName: config.TLSServerName,
+	}
+	if override == nil {
+		return settings
+	}
+	if override.CAFile != "" {
+		settings.CAFile = override.CAFile
+	}
+	if override.CertFile != "" {
+		settings.CertFile, settings.KeyFile = override.CertFile, override.KeyFile
+	}
+	if override.MinVersion != "" {
+		settings.MinVersion = override.MinVersion
+	}
+	if override.ServerName != "" {
+		settings.ServerName = override.ServerName
+	}
+	return settings
+}
+
+// newTLSConfig func returns the TLS configuration with the CA file added to the system
+// CAs, the server name, the minimum version and the client certificate, reloaded when
+// its files change. Settings come from tlsSettings.
+func newTLSConfig(override *domain.ReceiverTLS) (*tls.Config, error) {
+	settings := tlsSettings(override)
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: settings.ServerName,
+	}
+	if settings.MinVersion != "" {
+		version, ok := tlsVersions[settings.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown TLS version %q", settings.MinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+	if settings.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		content, err := ioutil.ReadFile(settings.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("no PEM certificates in %s", settings.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if settings.CertFile != "" {
+		reloader, err := newCertReloader(settings.CertFile, settings.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = reloader.getClientCertificate
+	}
+	return tlsConfig, nil
+}
+
+// certReloader keeps the client certificate and loads it again when its files change,
+// so rotated certificates are used in new connections without restarting watch mode
+type certReloader struct {
+	certFile string
+	keyFile  string
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modTime  time.Time
+}
+
+// newCertReloader func loads the certificate and fails when it is invalid
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+// getClientCertificate func is tls.Config.GetClientCertificate. When the files changed but
+// cannot be loaded, for example in the middle of a rotation, the previous certificate is used.
+func (r *certReloader) getClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if modTime, err := r.lastModified(); err == nil && !modTime.Equal(r.modTime) {
+		if err := r.load(); err != nil && config.Debug {
+			fmt.Fprintf(utils.Out(), "[SECRETRECEIVER] Cannot reload client certificate: %v \n", err)
+		}
+	}
+	return r.cert, nil
+}
+
+// reload func loads the certificate with the lock
+func (r *certReloader) reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.load()
+}
+
+// load func reads the certificate files and keeps their last modification time
+func (r *certReloader) load() error {
+	modTime, err := r.lastModified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("cannot load client certificate: %v", err)
+	}
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// lastModified func returns the latest modification time of the certificate and key files
+func (r *certReloader) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
@@ -0,0 +1,128 @@
+package gateway
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+// testCert creates a certificate signed by parent, or self signed without parent,
+// and returns it with its key in PEM
+func testCert(t *testing.T, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+	return cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	ca, caKey, caPEM, _ := testCert(t, "ca", nil, nil)
+	_, _, serverPEM, serverKeyPEM := testCert(t, "receiver.internal", ca, caKey)
+	_, _, clientPEM, clientKeyPEM := testCert(t, "cluster-a", ca, caKey)
+	write := func(name string, content []byte) string {
+		file := filepath.Join(dir, name)
+		assert.NoError(t, ioutil.WriteFile(file, content, 0600))
+		return file
+	}
+
+	serverCert, err := tls.X509KeyPair(serverPEM, serverKeyPEM)
+	assert.NoError(t, err)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(ca)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{serverCert}, ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	config.TLSCAFile = write("ca.crt", caPEM)
+	config.TLSCertFile = write("client.crt", clientPEM)
+	config.TLSKeyFile = write("client.key", clientKeyPEM)
+	config.TLSServerName = "receiver.internal"
+	defer func() {
+		config.TLSCAFile, config.TLSCertFile, config.TLSKeyFile, config.TLSServerName = "", "", "", ""
+	}()
+	transport, err := newTransport(nil)
+	assert.NoError(t, err)
+	client := &http.Client{Transport: transport}
+	get := func() string {
+		resp, err := client.Get(server.URL)
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return string(body)
+	}
+	assert.Equal(t, "cluster-a", get())
+
+	// a rotated certificate is used in the next connection
+	_, _, rotatedPEM, rotatedKeyPEM := testCert(t, "cluster-a-rotated", ca, caKey)
+	later := time.Now().Add(time.Minute)
+	write("client.crt", rotatedPEM)
+	write("client.key", rotatedKeyPEM)
+	assert.NoError(t, os.Chtimes(config.TLSCertFile, later, later))
+	transport.CloseIdleConnections()
+	assert.Equal(t, "cluster-a-rotated", get())
+
+	config.TLSServerName = "other.internal"
+	transport, err = newTransport(nil)
+	assert.NoError(t, err)
+	_, err = (&http.Client{Transport: transport}).Get(server.URL)
+	assert.Error(t, err)
+
+	// receiver settings replace the flags
+	transport, err = newTransport(&domain.ReceiverTLS{ServerName: "receiver.internal"})
+	assert.NoError(t, err)
+	client = &http.Client{Transport: transport}
+	assert.Equal(t, "cluster-a-rotated", get())
+
+	config.TLSMinVersion = "2.0"
+	_, err = newTLSConfig(nil)
+	assert.Error(t, err)
+	config.TLSMinVersion = ""
+	config.TLSCAFile = write("empty.crt", nil)
+	_, err = newTLSConfig(nil)
+	assert.Error(t, err)
+}
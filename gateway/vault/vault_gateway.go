@@ -0,0 +1,269 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	gateway "github.com/betorvs/secretpublisher/gateway/secret"
+	"github.com/betorvs/secretpublisher/utils"
+)
+
+// Repository struct writes secrets in a Vault KV v2 mount, in PREFIX/NAMESPACE/NAME.
+// Checksum, labels and annotations are kept in the custom metadata.
+type Repository struct {
+	Client *http.Client
+	// Address is the Vault URL without path, like https://vault:8200
+	Address string
+	Mount   string
+	Prefix  string
+	Token   string
+}
+
+// metadata keys used in custom_metadata
+const (
+	checksumKey        = "checksum"
+	checksumVersionKey = "checksumVersion"
+	typeKey            = "type"
+	immutableKey       = "immutable"
+	binaryKeysKey      = "binaryKeys"
+	labelPrefix        = "label."
+	annotationPrefix   = "annotation."
+)
+
+// NewRepository func creates a Repository from vault://HOST[:PORT]/MOUNT[/PREFIX], or vault+http://
+// for a Vault without TLS. The token is config.VaultToken.
+func NewRepository(destination *url.URL) (Repository, error) {
+	parts := strings.SplitN(strings.Trim(destination.Path, "/"), "/", 2)
+	if parts[0] == "" {
+		return Repository{}, utils.ErrorHandler(fmt.Errorf("vault destination needs a mount, like vault://vault:8200/secret"))
+	}
+	if config.VaultToken == "" {
+		return Repository{}, utils.ErrorHandler(fmt.Errorf("vault destination needs --vaultToken or VAULT_TOKEN environment variable"))
+	}
+	client, err := gateway.NewHTTPClient()
+	if err != nil {
+		return Repository{}, err
+	}
+	scheme := "https"
+	if destination.Scheme == "vault+http" {
+		scheme = "http"
+	}
+	repo := Repository{
+		Client:  client,
+		Address: fmt.Sprintf("%s://%s", scheme, destination.Host),
+		Mount:   parts[0],
+		Token:   config.VaultToken,
+	}
+	if len(parts) == 2 {
+		repo.Prefix = parts[1]
+	}
+	return repo, nil
+}
+
+// kvResponse is the body of GET /v1/MOUNT/data/PATH
+type kvResponse struct {
+	Data struct {
+		Data     map[string]string `json:"data"`
+		Metadata struct {
+			CustomMetadata map[string]string `json:"custom_metadata"`
+		} `json:"metadata"`
+	} `json:"data"`
+}
+
+// GetSecret func reads the latest version of a secret
+func (repo Repository) GetSecret(ctx context.Context, name string, namespace string) (*domain.SecretStatus, error) {
+	body, err := repo.do(ctx, "GET", repo.url("data", namespace, name), nil)
+	if errors.Is(err, domain.ErrNotFound) {
+		return &domain.SecretStatus{Found: false}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	response := &kvResponse{}
+	if err := json.Unmarshal(body, response); err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
+	// a deleted version has no data
+	if response.Data.Data == nil {
+		return &domain.SecretStatus{Found: false}, nil
+	}
+	secret := fromMetadata(response.Data.Metadata.CustomMetadata)
+	secret.Name = name
+	secret.Namespace = namespace
+	secret.Data = response.Data.Data
+	for _, k := range strings.Split(response.Data.Metadata.CustomMetadata[binaryKeysKey], ",") {
+		if v, ok := secret.Data[k]; ok && k != "" {
+			if secret.BinaryData == nil {
+				secret.BinaryData = make(map[string]string)
+			}
+			secret.BinaryData[k] = v
+			delete(secret.Data, k)
+		}
+	}
+	return &domain.SecretStatus{
+		Found:           true,
+		Checksum:        secret.Checksum,
+		ChecksumVersion: secret.ChecksumVersion,
+		Secret:          secret,
+	}, nil
+}
+
+// CreateSecret func writes the first version of a secret, it fails with domain.ErrConflict when it exists
+func (repo Repository) CreateSecret(ctx context.Context, secret *domain.Secret) error {
+	return repo.write(ctx, secret, map[string]interface{}{"cas": 0})
+}
+
+// UpdateSecret func writes a new version of a secret
+func (repo Repository) UpdateSecret(ctx context.Context, secret *domain.Secret) error {
+	return repo.write(ctx, secret, nil)
+}
+
+// DeleteSecret func deletes every version and the metadata of a secret
+func (repo Repository) DeleteSecret(ctx context.Context, name string, namespace string) error {
+	_, err := repo.do(ctx, "DELETE", repo.url("metadata", namespace, name), nil)
+	return err
+}
+
+// write func writes data and then the custom metadata. Metadata cannot go first, a create that
+// fails check-and-set would replace the metadata of the secret already there. When only the data
+// is written, the checksum in metadata is stale and the next scan sends the secret again.
+func (repo Repository) write(ctx context.Context, secret *domain.Secret, options map[string]interface{}) error {
+	if secret.Encrypted != nil {
+		return utils.ErrorHandler(errors.New("vault destination does not keep encrypted data, remove --encryptionKeyFile"))
+	}
+	if _, err := secret.RawData(); err != nil {
+		return utils.ErrorHandler(fmt.Errorf("%w: %v", domain.ErrBadRequest, err))
+	}
+	// Vault keeps strings, BinaryData stays base64 and its keys are in custom metadata
+	data := make(map[string]string, len(secret.Data)+len(secret.BinaryData))
+	for k, v := range secret.Data {
+		data[k] = v
+	}
+	for k, v := range secret.BinaryData {
+		data[k] = v
+	}
+	request := map[string]interface{}{"data": data}
+	if options != nil {
+		request["options"] = options
+	}
+	if _, err := repo.do(ctx, "POST", repo.url("data", secret.Namespace, secret.Name), request); err != nil {
+		if errors.Is(err, domain.ErrBadRequest) && options != nil {
+			// Vault answers 400 when check-and-set fails
+			return utils.ErrorHandler(fmt.Errorf("%w: %v", domain.ErrConflict, err))
+		}
+		return err
+	}
+	metadata := map[string]interface{}{"custom_metadata": toMetadata(secret)}
+	if _, err := repo.do(ctx, "POST", repo.url("metadata", secret.Namespace, secret.Name), metadata); err != nil {
+		return utils.ErrorHandler(fmt.Errorf("partial write, data was written but not its metadata: %w", err))
+	}
+	return nil
+}
+
+// url func returns the API URL for kind data or metadata
+func (repo Repository) url(kind, namespace, name string) string {
+	return fmt.Sprintf("%s/v1/%s", repo.Address, path.Join(repo.Mount, kind, repo.Prefix, namespace, name))
+}
+
+// do func sends one request with the token and returns the body,
+// or a domain.StatusError for any status above 204
+func (repo Repository) do(ctx context.Context, method, url string, request interface{}) ([]byte, error) {
+	var reader io.Reader
+	if request != nil {
+		body, err := json.Marshal(request)
+		if err != nil {
+			return nil, utils.ErrorHandler(err)
+		}
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
+	req.Header.Set("X-Vault-Token", repo.Token)
+	if request != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := repo.Client.Do(req)
+	if err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
+	if config.Debug {
+		fmt.Fprintf(utils.Out(), "[VAULT] %s %s Response Code: %s \n", method, url, resp.Status)
+	}
+	if resp.StatusCode > 204 {
+		return nil, domain.NewStatusError(resp.StatusCode, resp.Status)
+	}
+	return body, nil
+}
+
+// toMetadata func returns checksum, labels and annotations as custom metadata
+func toMetadata(secret *domain.Secret) map[string]string {
+	metadata := map[string]string{checksumKey: secret.Checksum}
+	if secret.ChecksumVersion != "" {
+		metadata[checksumVersionKey] = secret.ChecksumVersion
+	}
+	if secret.Type != "" {
+		metadata[typeKey] = secret.Type
+	}
+	if secret.Immutable {
+		metadata[immutableKey] = "true"
+	}
+	if len(secret.BinaryData) != 0 {
+		keys := make([]string, 0, len(secret.BinaryData))
+		for k := range secret.BinaryData {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		metadata[binaryKeysKey] = strings.Join(keys, ",")
+	}
+	for k, v := range secret.Labels {
+		metadata[labelPrefix+k] = v
+	}
+	for k, v := range secret.Annotations {
+		metadata[annotationPrefix+k] = v
+	}
+	return metadata
+}
+
+// fromMetadata func reads what toMetadata wrote
+func fromMetadata(metadata map[string]string) *domain.Secret {
+	secret := &domain.Secret{
+		Checksum:        metadata[checksumKey],
+		ChecksumVersion: metadata[checksumVersionKey],
+		Type:            metadata[typeKey],
+		Immutable:       metadata[immutableKey] == "true",
+	}
+	for k, v := range metadata {
+		switch {
+		case strings.HasPrefix(k, labelPrefix):
+			if secret.Labels == nil {
+				secret.Labels = make(map[string]string)
+			}
+			secret.Labels[strings.TrimPrefix(k, labelPrefix)] = v
+		case strings.HasPrefix(k, annotationPrefix):
+			if secret.Annotations == nil {
+				secret.Annotations = make(map[string]string)
+			}
+			secret.Annotations[strings.TrimPrefix(k, annotationPrefix)] = v
+		}
+	}
+	return secret
+}
@@ -0,0 +1,178 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+// kvStub keeps the last version of every path like a Vault KV v2 mount named secret
+type kvStub struct {
+	mu       sync.Mutex
+	data     map[string]map[string]string
+	metadata map[string]map[string]string
+	// failMetadata answers 500 to metadata writes
+	failMetadata bool
+}
+
+func (stub *kvStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if r.Header.Get("X-Vault-Token") != "root" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	var kind, key string
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/secret/data/"):
+		kind, key = "data", strings.TrimPrefix(r.URL.Path, "/v1/secret/data/")
+	case strings.HasPrefix(r.URL.Path, "/v1/secret/metadata/"):
+		kind, key = "metadata", strings.TrimPrefix(r.URL.Path, "/v1/secret/metadata/")
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	switch {
+	case r.Method == "GET" && kind == "data":
+		data, ok := stub.data[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+			"data":     data,
+			"metadata": map[string]interface{}{"custom_metadata": stub.metadata[key]},
+		}})
+	case r.Method == "POST" && kind == "data":
+		request := struct {
+			Data    map[string]string `json:"data"`
+			Options map[string]int    `json:"options"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&request)
+		if cas, ok := request.Options["cas"]; ok && cas == 0 && stub.data[key] != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		stub.data[key] = request.Data
+		w.Write([]byte(`{"data":{"version":1}}`))
+	case r.Method == "POST" && kind == "metadata":
+		if stub.failMetadata {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		request := struct {
+			CustomMetadata map[string]string `json:"custom_metadata"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&request)
+		stub.metadata[key] = request.CustomMetadata
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "DELETE" && kind == "metadata":
+		delete(stub.data, key)
+		delete(stub.metadata, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestRepository(t *testing.T) {
+	stub := &kvStub{data: make(map[string]map[string]string), metadata: make(map[string]map[string]string)}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	destination, _ := url.Parse(strings.Replace(server.URL, "http://", "vault+http://", 1) + "/secret/clusters/a")
+	_, err := NewRepository(destination)
+	assert.Error(t, err)
+	config.VaultToken = "root"
+	defer func() { config.VaultToken = "" }()
+	repo, err := NewRepository(destination)
+	assert.NoError(t, err)
+	assert.Equal(t, server.URL, repo.Address)
+	assert.Equal(t, server.URL+"/v1/secret/data/clusters/a/default/foo", repo.url("data", "default", "foo"))
+
+	ctx := context.Background()
+	status, err := repo.GetSecret(ctx, "foo", "default")
+	assert.NoError(t, err)
+	assert.False(t, status.Found)
+
+	secret := &domain.Secret{Name: "foo", Namespace: "default", Checksum: "abc", Data: map[string]string{"user": "admin"}, Labels: map[string]string{"app": "foo"}}
+	assert.NoError(t, repo.CreateSecret(ctx, secret))
+	err = repo.CreateSecret(ctx, secret)
+	assert.True(t, errors.Is(err, domain.ErrConflict))
+	status, err = repo.GetSecret(ctx, "foo", "default")
+	assert.NoError(t, err)
+	assert.True(t, status.Found)
+	assert.Equal(t, "abc", status.Checksum)
+	assert.Equal(t, "admin", status.Secret.Data["user"])
+	assert.Equal(t, "foo", status.Secret.Labels["app"])
+
+	secret.Checksum = "def"
+	assert.NoError(t, repo.UpdateSecret(ctx, secret))
+	status, _ = repo.GetSecret(ctx, "foo", "default")
+	assert.Equal(t, "def", status.Checksum)
+
+	secret.Type = "kubernetes.io/tls"
+	secret.Immutable = true
+	secret.BinaryData = map[string]string{"keystore": "/wD+"}
+	assert.NoError(t, repo.UpdateSecret(ctx, secret))
+	assert.Equal(t, "/wD+", stub.data["clusters/a/default/foo"]["keystore"])
+	status, _ = repo.GetSecret(ctx, "foo", "default")
+	assert.Equal(t, secret.Type, status.Secret.Type)
+	assert.True(t, status.Secret.Immutable)
+	assert.Equal(t, secret.Data, status.Secret.Data)
+	assert.Equal(t, secret.BinaryData, status.Secret.BinaryData)
+
+	assert.NoError(t, repo.DeleteSecret(ctx, "foo", "default"))
+	status, _ = repo.GetSecret(ctx, "foo", "default")
+	assert.False(t, status.Found)
+
+	repo.Token = "wrong"
+	_, err = repo.GetSecret(ctx, "foo", "default")
+	assert.Error(t, err)
+}
+
+func TestRepositoryPartialWrite(t *testing.T) {
+	stub := &kvStub{data: make(map[string]map[string]string), metadata: make(map[string]map[string]string)}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+	repo := Repository{Client: server.Client(), Address: server.URL, Token: "root", Mount: "secret"}
+	ctx := context.Background()
+
+	secret := &domain.Secret{Name: "foo", Namespace: "default", Checksum: "abc", Data: map[string]string{"user": "admin"}}
+	assert.NoError(t, repo.CreateSecret(ctx, secret))
+
+	stub.failMetadata = true
+	secret.Checksum = "def"
+	secret.Data = map[string]string{"user": "root"}
+	err := repo.UpdateSecret(ctx, secret)
+	assert.Contains(t, err.Error(), "partial write, data was written but not its metadata")
+	var statusError *domain.StatusError
+	assert.True(t, errors.As(err, &statusError))
+	assert.Equal(t, http.StatusInternalServerError, statusError.StatusCode)
+	// the stale checksum makes the next scan send it again
+	status, err := repo.GetSecret(ctx, "foo", "default")
+	assert.NoError(t, err)
+	assert.Equal(t, "root", status.Secret.Data["user"])
+	assert.Equal(t, "abc", status.Checksum)
+
+	// a create that fails check-and-set leaves the metadata of the secret already there
+	stub.failMetadata = false
+	err = repo.CreateSecret(ctx, secret)
+	assert.True(t, errors.Is(err, domain.ErrConflict))
+	status, _ = repo.GetSecret(ctx, "foo", "default")
+	assert.Equal(t, "abc", status.Checksum)
+
+	assert.NoError(t, repo.UpdateSecret(ctx, secret))
+	status, _ = repo.GetSecret(ctx, "foo", "default")
+	assert.Equal(t, "def", status.Checksum)
+}
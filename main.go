@@ -1,14 +1,23 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
+	"github.com/betorvs/secretpublisher/appcontext"
 	"github.com/betorvs/secretpublisher/config"
-	_ "github.com/betorvs/secretpublisher/gateway/secret"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/betorvs/secretpublisher/gateway/backend"
+	gateway "github.com/betorvs/secretpublisher/gateway/secret"
 	"github.com/betorvs/secretpublisher/usecase"
+	"github.com/betorvs/secretpublisher/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -20,10 +29,15 @@ var (
 )
 
 var versionCmd = &cobra.Command{
-	Use:   "version",
-	Short: "Print the version number of usernamectl",
-	Long:  `All software has versions.`,
+	Use:         "version",
+	Annotations: map[string]string{config.SkipReceiver: "true"},
+	Short:       "Print the version number of usernamectl",
+	Long:        `All software has versions.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		if config.Output == "json" || config.Output == "yaml" {
+			utils.PrintValue(os.Stdout, config.Output, map[string]string{"version": Version, "build": BuildInfo})
+			os.Exit(0)
+		}
 		if BuildInfo != "" {
 			fmt.Printf("secretpublisher command line tools version: %s, build: %s\n", Version, BuildInfo)
 			os.Exit(0)
@@ -37,7 +51,7 @@ var existCmd = &cobra.Command{
 	Use:   "exist",
 	Short: "exist SECRET_NAME",
 	Args: func(cmd *cobra.Command, args []string) error {
-		if len(args) > 1 {
+		if len(args) != 1 {
 			return errors.New("[ERROR] Need at least secret name")
 		}
 		return nil
@@ -45,11 +59,75 @@ var existCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		secretName := args[0]
 		secret := usecase.GenerateSecret(secretName)
-		err := usecase.ManageSecret(secretName, secret)
-		if err != nil {
-			fmt.Printf("%v", err)
-			os.Exit(2)
+		result, err := usecase.ManageSecret(cmd.Context(), secretName, secret)
+		render(singleReport(result), err)
+	},
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "diff SECRET_NAME | diff scan-secrets|scan-configmaps|secret-subvalue label=value",
+	Long:  "Print what exist would do with SECRET_NAME, or what a scan command would do with the secrets matching label=value, without sending anything to Secret Receiver",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("[ERROR] Need exactly one secret name")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		config.DryRun = true
+		secretName := args[0]
+		secret := usecase.GenerateSecret(secretName)
+		result, err := usecase.ManageSecret(cmd.Context(), secretName, secret)
+		render(singleReport(result), err)
+	},
+}
+
+var diffScanSecretsCmd = &cobra.Command{
+	Use:   "scan-secrets",
+	Short: "diff scan-secrets label=value",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("[ERROR] Need label=value")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		config.DryRun = true
+		render(usecase.ScanSecret(cmd.Context(), args[0]))
+	},
+}
+
+var diffScanCMCmd = &cobra.Command{
+	Use:   "scan-configmaps",
+	Short: "diff scan-configmaps label=value",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("[ERROR] Need label=value")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		config.DryRun = true
+		render(usecase.ScanConfigMap(cmd.Context(), args[0]))
+	},
+}
+
+var diffSecretsValuesCmd = &cobra.Command{
+	Use:   "secret-subvalue",
+	Short: "diff secret-subvalue label=value",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return errors.New("[ERROR] Need label=value")
+		}
+		if !strings.Contains(config.MatchKey, ".") {
+			return errors.New("--matchKey key.subkey")
 		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		config.DryRun = true
+		render(usecase.ScanSubvalueSecret(cmd.Context(), args[0]))
 	},
 }
 
@@ -57,7 +135,7 @@ var createCmd = &cobra.Command{
 	Use:   "create",
 	Short: "create SECRET_NAME",
 	Args: func(cmd *cobra.Command, args []string) error {
-		if len(args) > 1 {
+		if len(args) != 1 {
 			return errors.New("[ERROR] Need at least secret name")
 		}
 		return nil
@@ -65,11 +143,9 @@ var createCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		secretName := args[0]
 		secret := usecase.GenerateSecret(secretName)
-		err := usecase.CreateSecret(secretName, secret)
-		if err != nil {
-			fmt.Printf("%v", err)
-			os.Exit(2)
-		}
+		start := time.Now()
+		err := usecase.CreateSecret(cmd.Context(), secretName, secret)
+		render(singleReport(usecase.NewResult(secretName, secret.Namespace, domain.ActionCreated, start, err)), err)
 	},
 }
 
@@ -77,7 +153,7 @@ var updateCmd = &cobra.Command{
 	Use:   "update",
 	Short: "update SECRET_NAME",
 	Args: func(cmd *cobra.Command, args []string) error {
-		if len(args) > 1 {
+		if len(args) != 1 {
 			return errors.New("[ERROR] Need at least secret name")
 		}
 		return nil
@@ -85,11 +161,9 @@ var updateCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		secretName := args[0]
 		secret := usecase.GenerateSecret(secretName)
-		err := usecase.UpdateSecret(secretName, secret)
-		if err != nil {
-			fmt.Printf("%v", err)
-			os.Exit(2)
-		}
+		start := time.Now()
+		err := usecase.UpdateSecret(cmd.Context(), secretName, secret)
+		render(singleReport(usecase.NewResult(secretName, secret.Namespace, domain.ActionUpdated, start, err)), err)
 	},
 }
 
@@ -97,19 +171,32 @@ var checkCmd = &cobra.Command{
 	Use:   "check",
 	Short: "check SECRET_NAME",
 	Args: func(cmd *cobra.Command, args []string) error {
-		if len(args) > 1 {
+		if len(args) != 1 {
 			return errors.New("[ERROR] Need at least secret name")
 		}
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		secretName := args[0]
-		res, err := usecase.CheckSecret(secretName, config.SecretNamespace)
+		start := time.Now()
+		res, err := usecase.CheckSecret(cmd.Context(), secretName, config.SecretNamespace)
+		if utils.Structured() {
+			result := usecase.NewResult(secretName, config.SecretNamespace, domain.ActionNotFound, start, err)
+			if res != nil && res.Found {
+				result.Action = domain.ActionFound
+				result.ChecksumBefore = res.Checksum
+			}
+			render(singleReport(result), err)
+			return
+		}
 		if err != nil {
-			fmt.Printf("%v", err)
-			os.Exit(2)
+			render(nil, err)
+		}
+		if !res.Found {
+			fmt.Println("notFound")
+			return
 		}
-		fmt.Printf("%s", res)
+		fmt.Println(res.Checksum)
 	},
 }
 
@@ -117,18 +204,16 @@ var deleteCmd = &cobra.Command{
 	Use:   "delete",
 	Short: "delete SECRET_NAME",
 	Args: func(cmd *cobra.Command, args []string) error {
-		if len(args) > 1 {
+		if len(args) != 1 {
 			return errors.New("Need at least secret name")
 		}
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		secretName := args[0]
-		err := usecase.DeleteSecret(secretName)
-		if err != nil {
-			fmt.Printf("%v", err)
-			os.Exit(2)
-		}
+		start := time.Now()
+		err := usecase.DeleteSecret(cmd.Context(), secretName)
+		render(singleReport(usecase.NewResult(secretName, config.SecretNamespace, domain.ActionDeleted, start, err)), err)
 	},
 }
 
@@ -136,19 +221,21 @@ var scanSecretsCmd = &cobra.Command{
 	Use:   "scan-secrets",
 	Short: "scan-secrets label=value",
 	Args: func(cmd *cobra.Command, args []string) error {
-		if len(args) > 1 {
+		if len(args) != 1 {
 			return errors.New("[ERROR] Need label=value")
 		}
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		labels := args[0]
-		res, err := usecase.ScanSecret(labels)
-		if err != nil {
-			fmt.Printf("%v", err)
-			os.Exit(2)
+		if config.Watch {
+			if err := usecase.Watch(cmd.Context(), usecase.KindSecrets, labels); err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(2)
+			}
+			return
 		}
-		fmt.Printf("%s", res)
+		render(usecase.ScanSecret(cmd.Context(), labels))
 	},
 }
 
@@ -156,19 +243,21 @@ var scanCMCmd = &cobra.Command{
 	Use:   "scan-configmaps",
 	Short: "scan-configmaps label=value",
 	Args: func(cmd *cobra.Command, args []string) error {
-		if len(args) > 1 {
+		if len(args) != 1 {
 			return errors.New("[ERROR] Need label=value")
 		}
 		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		labels := args[0]
-		res, err := usecase.ScanConfigMap(labels)
-		if err != nil {
-			fmt.Printf("%v", err)
-			os.Exit(2)
+		if config.Watch {
+			if err := usecase.Watch(cmd.Context(), usecase.KindConfigMaps, labels); err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(2)
+			}
+			return
 		}
-		fmt.Printf("%s", res)
+		render(usecase.ScanConfigMap(cmd.Context(), labels))
 	},
 }
 
@@ -176,7 +265,7 @@ var scanSecretsValuesCmd = &cobra.Command{
 	Use:   "secret-subvalue",
 	Short: "secret-subvalue label=value",
 	Args: func(cmd *cobra.Command, args []string) error {
-		if len(args) > 1 {
+		if len(args) != 1 {
 			return errors.New("[ERROR] Need label=value")
 		}
 		if !strings.Contains(config.MatchKey, ".") {
@@ -186,52 +275,363 @@ var scanSecretsValuesCmd = &cobra.Command{
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		labels := args[0]
-		res, err := usecase.ScanSubvalueSecret(labels)
+		if config.Watch {
+			if err := usecase.Watch(cmd.Context(), usecase.KindSubvalue, labels); err != nil {
+				fmt.Printf("%v", err)
+				os.Exit(2)
+			}
+			return
+		}
+		render(usecase.ScanSubvalueSecret(cmd.Context(), labels))
+	},
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "verify secrets|configmaps|subvalue label=value",
+	Long:  "verify compares the secrets the scan commands would send with Secret Receiver without writing anything. It exits with 3 when secrets are drifted or missing and 2 on errors.",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return errors.New("[ERROR] Need secrets|configmaps|subvalue label=value")
+		}
+		switch args[0] {
+		case usecase.KindSecrets, usecase.KindConfigMaps:
+		case usecase.KindSubvalue:
+			if !strings.Contains(config.MatchKey, ".") {
+				return errors.New("--matchKey key.subkey")
+			}
+		default:
+			return fmt.Errorf("[ERROR] Unknown kind %s, use secrets, configmaps or subvalue", args[0])
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		res, err := usecase.Verify(cmd.Context(), args[0], args[1])
+		if res != nil && !utils.Structured() {
+			// the summary is printed with drift and errors too
+			fmt.Printf("%s", res.Message)
+			res = nil
+		}
+		render(res, err)
+	},
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply",
+	Short: "apply -f FILE",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if config.ApplyFile == "" {
+			return errors.New("[ERROR] Need -f FILE")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		res, err := usecase.ApplySecrets(cmd.Context(), config.ApplyFile)
+		if res != nil && !utils.Structured() {
+			// the summary is printed with the errors too
+			fmt.Printf("%s", res.Message)
+			res = nil
+		}
+		render(res, err)
+	},
+}
+
+var rotateKeyCmd = &cobra.Command{
+	Use:         "rotate-key",
+	Annotations: map[string]string{config.SkipReceiver: "true"},
+	Short:       "rotate-key [KEY_ID]",
+	Long:        "Add a new signing key to --keyringFile or --keyringSecret, used after --activateIn, while the other keys stay valid for --gracePeriod",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) > 1 {
+			return errors.New("[ERROR] Need at most one key id")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		var keyID string
+		if len(args) == 1 {
+			keyID = args[0]
+		}
+		keyring, err := usecase.RotateKey(keyID)
 		if err != nil {
 			fmt.Printf("%v", err)
 			os.Exit(2)
 		}
-		fmt.Printf("%s", res)
+		if config.Output == "json" || config.Output == "yaml" {
+			utils.PrintValue(os.Stdout, config.Output, usecase.RedactKeyring(keyring))
+			return
+		}
+		for _, key := range keyring.Keys {
+			fmt.Printf("%s\t%s\n", key.ID, usecase.KeyValidity(key))
+		}
+	},
+}
+
+var keygenCmd = &cobra.Command{
+	Use:         "keygen",
+	Annotations: map[string]string{config.SkipReceiver: "true"},
+	Short:       "keygen [--keyType x25519] [--privateKeyFile FILE]",
+	Long:        "Create an Ed25519 key pair for --signingMode ed25519, or with --keyType x25519 a key pair for --encryptionKeyFile. The private key is written to --privateKeyFile, or printed without it, and the public key is printed",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if config.KeyType != "ed25519" && config.KeyType != "x25519" {
+			return errors.New("[ERROR] --keyType must be ed25519 or x25519")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		generate := gateway.GenerateEd25519Key
+		if config.KeyType == "x25519" {
+			generate = usecase.GenerateEncryptionKey
+		}
+		pair, err := generate()
+		if err != nil {
+			fmt.Printf("%v", err)
+			os.Exit(2)
+		}
+		if config.PrivateKeyFile != "" {
+			// O_EXCL does not replace a key in use
+			file, err := os.OpenFile(config.PrivateKeyFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+			if err == nil {
+				_, err = file.WriteString(pair.PrivateKey)
+				if errClose := file.Close(); err == nil {
+					err = errClose
+				}
+			}
+			if err != nil {
+				fmt.Printf("[ERROR] Cannot write private key: %v", err)
+				os.Exit(2)
+			}
+			pair.PrivateKey = ""
+		}
+		if config.Output == "json" || config.Output == "yaml" {
+			utils.PrintValue(os.Stdout, config.Output, pair)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "[INFO] Key ID: %s\n", pair.ID)
+		fmt.Printf("%s%s", pair.PrivateKey, pair.PublicKey)
+	},
+}
+
+var decryptCmd = &cobra.Command{
+	Use:         "decrypt",
+	Annotations: map[string]string{config.SkipReceiver: "true"},
+	Short:       "decrypt -f FILE --decryptionKeyFile KEY",
+	Long:        "Decrypt a secret body encrypted with --encryptionKeyFile, like Secret Receiver does, to test the keys",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if config.DecryptionKeyFile == "" {
+			return errors.New("[ERROR] Need --decryptionKeyFile KEY")
+		}
+		return nil
+	},
+	Run: func(cmd *cobra.Command, args []string) {
+		secret, err := usecase.ReadEncryptedSecret(config.InputFile)
+		if err == nil {
+			var key []byte
+			key, err = ioutil.ReadFile(config.DecryptionKeyFile)
+			if err == nil {
+				err = usecase.DecryptSecret(secret, key)
+			}
+		}
+		if err != nil {
+			fmt.Printf("%v", err)
+			os.Exit(2)
+		}
+		format := "json"
+		if config.Output == "yaml" {
+			format = "yaml"
+		}
+		utils.PrintValue(os.Stdout, format, secret)
+	},
+}
+
+var mockReceiverCmd = &cobra.Command{
+	Use:         "mock-receiver",
+	Annotations: map[string]string{config.SkipReceiver: "true"},
+	Short:       "mock-receiver [--listen :8080]",
+	Long:        "Serve the Secret Receiver API in memory to test secretpublisher end to end, verifying signatures with --encodingRequest, --keyringFile or --publicKeyFile",
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := usecase.RunMockReceiver(); err != nil {
+			fmt.Printf("%v", err)
+			os.Exit(2)
+		}
+	},
+}
+
+var configCmd = &cobra.Command{
+	Use:         "config",
+	Annotations: map[string]string{config.SkipReceiver: "true"},
+	Short:       "config view",
+	Long:        "Manage the config file with named profiles selected by --profile",
+}
+
+var configViewCmd = &cobra.Command{
+	Use:         "view",
+	Annotations: map[string]string{config.ShowEnvErrors: "true"},
+	Short:       "view [--profile PROFILE]",
+	Long:        "Print the effective configuration and where each setting came from, with secrets redacted and invalid environment variables with their error",
+	Run: func(cmd *cobra.Command, args []string) {
+		utils.PrintConfigView(os.Stdout, config.Output, config.View(cmd))
 	},
 }
 
 func initCommands() {
-	existCmd.Flags().StringVar(&config.SecretNamespace, "secretNamespace", os.Getenv("SECRET_NAMESPACE"), "Secret namespace in Kubernetes")
-	existCmd.Flags().StringToStringVar(&config.StringData, "stringData", config.ParseStringData("data"), "map for stringData in secret, use: key=value")
-	existCmd.Flags().StringToStringVar(&config.Labels, "labels", config.ParseStringData("labels"), "map for labels in secret, use: key=value")
-	existCmd.Flags().StringToStringVar(&config.Annotations, "annotations", config.ParseStringData("annotations"), "map for annotations in secret, use: key=value")
-	createCmd.Flags().StringVar(&config.SecretNamespace, "secretNamespace", os.Getenv("SECRET_NAMESPACE"), "Secret namespace in Kubernetes")
-	createCmd.Flags().StringToStringVar(&config.StringData, "stringData", config.ParseStringData("data"), "map for stringData in secret, use: key=value")
-	createCmd.Flags().StringToStringVar(&config.Labels, "labels", config.ParseStringData("labels"), "map for labels in secret, use: key=value")
-	createCmd.Flags().StringToStringVar(&config.Annotations, "annotations", config.ParseStringData("annotations"), "map for annotations in secret, use: key=value")
-	updateCmd.Flags().StringVar(&config.SecretNamespace, "secretNamespace", os.Getenv("SECRET_NAMESPACE"), "Secret namespace in Kubernetes")
-	updateCmd.Flags().StringToStringVar(&config.StringData, "stringData", config.ParseStringData("data"), "map for stringData in secret, use: key=value")
-	updateCmd.Flags().StringToStringVar(&config.Labels, "labels", config.ParseStringData("labels"), "map for labels in secret, use: key=value")
-	updateCmd.Flags().StringToStringVar(&config.Annotations, "annotations", config.ParseStringData("annotations"), "map for annotations in secret, use: key=value")
-	checkCmd.Flags().StringVar(&config.SecretNamespace, "secretNamespace", os.Getenv("SECRET_NAMESPACE"), "Secret namespace in Kubernetes")
-	deleteCmd.Flags().StringVar(&config.SecretNamespace, "secretNamespace", os.Getenv("SECRET_NAMESPACE"), "Secret namespace in Kubernetes")
-	scanSecretsCmd.Flags().StringVar(&config.SecretNamespace, "secretNamespace", os.Getenv("SECRET_NAMESPACE"), "Secret namespace in Kubernetes")
-	scanSecretsCmd.Flags().StringVar(&config.DestinationNamespace, "destinationNamespace", os.Getenv("DESTINATION_NAMESPACE"), "Destination Secret namespace in Secret Receiver")
-	scanSecretsCmd.Flags().StringVar(&config.NameSuffix, "nameSuffix", os.Getenv("NAME_SUFFIX"), "Destination Secret name suffix in Secret Receiver")
-	scanCMCmd.Flags().StringVar(&config.SecretNamespace, "secretNamespace", os.Getenv("SECRET_NAMESPACE"), "Secret namespace in Kubernetes")
-	scanCMCmd.Flags().StringVar(&config.DestinationNamespace, "destinationNamespace", os.Getenv("DESTINATION_NAMESPACE"), "Destination Secret namespace in Secret Receiver")
-	scanCMCmd.Flags().StringVar(&config.NameSuffix, "nameSuffix", os.Getenv("NAME_SUFFIX"), "Destination Secret name suffix in Secret Receiver")
-	scanSecretsValuesCmd.Flags().StringVar(&config.SecretNamespace, "secretNamespace", os.Getenv("SECRET_NAMESPACE"), "Secret namespace in Kubernetes")
-	scanSecretsValuesCmd.Flags().StringVar(&config.DestinationNamespace, "destinationNamespace", os.Getenv("DESTINATION_NAMESPACE"), "Destination Secret namespace in Secret Receiver")
-	scanSecretsValuesCmd.Flags().StringVar(&config.NameSuffix, "nameSuffix", os.Getenv("NAME_SUFFIX"), "Destination Secret name suffix in Secret Receiver")
-	scanSecretsValuesCmd.Flags().StringVar(&config.KeyNameSuffix, "keyNameSuffix", os.Getenv("KEY_NAME_SUFFIX"), "Key inside Secret to be used as value in new secret to send to Secret Receiver")
-	scanSecretsValuesCmd.Flags().StringVar(&config.MatchKey, "matchKey", os.Getenv("MATCH_KEY"), "Key inside Secret to be exported to Secret Receiver")
-	scanSecretsValuesCmd.Flags().StringVar(&config.NewLabels, "newLabels", os.Getenv("NEW_LABELS"), "New Labels to be exported to Secret Receiver")
-	scanSecretsValuesCmd.Flags().StringVar(&config.NewAnnotations, "newAnnotations", os.Getenv("NEW_ANNOTATIONS"), "New Annotations to be exported to Secret Receiver")
-	scanSecretsValuesCmd.Flags().StringVar(&config.DisabledLabel, "disabledLabel", os.Getenv("DISABLED_LABEL"), "Label to not export to Secret Receiver")
-	scanSecretsValuesCmd.Flags().StringVar(&config.MiddleName, "middleName", os.Getenv("MIDDLE_NAME"), "Add middle name in secret data name before sending to Secret Receiver")
+	config.StringEnvVar(existCmd.Flags(), &config.SecretNamespace, "secretNamespace", "SECRET_NAMESPACE", "Secret namespace in Kubernetes")
+	config.KeyValuesEnvVar(existCmd.Flags(), &config.StringData, "stringData", "STRING_DATA", "map for stringData in secret, use: key=value,key=\"value, with comma\"")
+	config.KeyValuesEnvVar(existCmd.Flags(), &config.Labels, "labels", "LABELS", "map for labels in secret, use: key=value,key=\"value, with comma\"")
+	config.KeyValuesEnvVar(existCmd.Flags(), &config.Annotations, "annotations", "ANNOTATIONS", "map for annotations in secret, use: key=value,key=\"value, with comma\"")
+	config.StringEnvVar(diffCmd.Flags(), &config.SecretNamespace, "secretNamespace", "SECRET_NAMESPACE", "Secret namespace in Kubernetes")
+	config.KeyValuesEnvVar(diffCmd.Flags(), &config.StringData, "stringData", "STRING_DATA", "map for stringData in secret, use: key=value,key=\"value, with comma\"")
+	config.KeyValuesEnvVar(diffCmd.Flags(), &config.Labels, "labels", "LABELS", "map for labels in secret, use: key=value,key=\"value, with comma\"")
+	config.KeyValuesEnvVar(diffCmd.Flags(), &config.Annotations, "annotations", "ANNOTATIONS", "map for annotations in secret, use: key=value,key=\"value, with comma\"")
+	config.StringEnvVar(createCmd.Flags(), &config.SecretNamespace, "secretNamespace", "SECRET_NAMESPACE", "Secret namespace in Kubernetes")
+	config.KeyValuesEnvVar(createCmd.Flags(), &config.StringData, "stringData", "STRING_DATA", "map for stringData in secret, use: key=value,key=\"value, with comma\"")
+	config.KeyValuesEnvVar(createCmd.Flags(), &config.Labels, "labels", "LABELS", "map for labels in secret, use: key=value,key=\"value, with comma\"")
+	config.KeyValuesEnvVar(createCmd.Flags(), &config.Annotations, "annotations", "ANNOTATIONS", "map for annotations in secret, use: key=value,key=\"value, with comma\"")
+	config.StringEnvVar(updateCmd.Flags(), &config.SecretNamespace, "secretNamespace", "SECRET_NAMESPACE", "Secret namespace in Kubernetes")
+	config.KeyValuesEnvVar(updateCmd.Flags(), &config.StringData, "stringData", "STRING_DATA", "map for stringData in secret, use: key=value,key=\"value, with comma\"")
+	config.KeyValuesEnvVar(updateCmd.Flags(), &config.Labels, "labels", "LABELS", "map for labels in secret, use: key=value,key=\"value, with comma\"")
+	config.KeyValuesEnvVar(updateCmd.Flags(), &config.Annotations, "annotations", "ANNOTATIONS", "map for annotations in secret, use: key=value,key=\"value, with comma\"")
+	for _, cmd := range []*cobra.Command{existCmd, diffCmd, createCmd, updateCmd} {
+		cmd.Flags().StringArrayVar(&config.FromLiterals, "from-literal", nil, "secret data key=value, repeatable")
+		cmd.Flags().StringArrayVar(&config.FromFiles, "from-file", nil, "secret data from [key=]path, the key is the file name by default, a directory adds every file in it, repeatable")
+		cmd.Flags().StringArrayVar(&config.FromEnvFiles, "from-env-file", nil, "secret data from a file with KEY=VALUE lines, repeatable")
+		cmd.Flags().BoolVar(&config.Stdin, "stdin", false, "secret data from a JSON or YAML map read from stdin")
+	}
+	config.StringEnvVar(checkCmd.Flags(), &config.SecretNamespace, "secretNamespace", "SECRET_NAMESPACE", "Secret namespace in Kubernetes")
+	config.StringEnvVar(deleteCmd.Flags(), &config.SecretNamespace, "secretNamespace", "SECRET_NAMESPACE", "Secret namespace in Kubernetes")
+	for _, cmd := range []*cobra.Command{scanSecretsCmd, scanCMCmd, scanSecretsValuesCmd, diffScanSecretsCmd, diffScanCMCmd, diffSecretsValuesCmd} {
+		config.StringEnvVar(cmd.Flags(), &config.SecretNamespace, "secretNamespace", "SECRET_NAMESPACE", "Secret namespace in Kubernetes")
+		config.StringEnvVar(cmd.Flags(), &config.DestinationNamespace, "destinationNamespace", "DESTINATION_NAMESPACE", "Destination Secret namespace in Secret Receiver")
+		config.StringEnvVar(cmd.Flags(), &config.NameSuffix, "nameSuffix", "NAME_SUFFIX", "Destination Secret name suffix in Secret Receiver")
+	}
+	for _, cmd := range []*cobra.Command{scanSecretsValuesCmd, diffSecretsValuesCmd} {
+		config.StringEnvVar(cmd.Flags(), &config.KeyNameSuffix, "keyNameSuffix", "KEY_NAME_SUFFIX", "Key inside Secret to be used as value in new secret to send to Secret Receiver")
+		config.StringEnvVar(cmd.Flags(), &config.MatchKey, "matchKey", "MATCH_KEY", "Key inside Secret to be exported to Secret Receiver")
+		config.StringEnvVar(cmd.Flags(), &config.NewLabels, "newLabels", "NEW_LABELS", "New Labels to be exported to Secret Receiver, use: key=value,key=value")
+		config.StringEnvVar(cmd.Flags(), &config.NewAnnotations, "newAnnotations", "NEW_ANNOTATIONS", "New Annotations to be exported to Secret Receiver, use: key=value,key=value")
+		config.StringEnvVar(cmd.Flags(), &config.DisabledLabel, "disabledLabel", "DISABLED_LABEL", "Label to not export to Secret Receiver")
+		config.StringEnvVar(cmd.Flags(), &config.MiddleName, "middleName", "MIDDLE_NAME", "Add middle name in secret data name before sending to Secret Receiver")
+	}
+	diffCmd.AddCommand(diffScanSecretsCmd, diffScanCMCmd, diffSecretsValuesCmd)
+	config.StringEnvVar(verifyCmd.Flags(), &config.SecretNamespace, "secretNamespace", "SECRET_NAMESPACE", "Secret namespace in Kubernetes")
+	config.StringEnvVar(verifyCmd.Flags(), &config.DestinationNamespace, "destinationNamespace", "DESTINATION_NAMESPACE", "Destination Secret namespace in Secret Receiver")
+	config.StringEnvVar(verifyCmd.Flags(), &config.NameSuffix, "nameSuffix", "NAME_SUFFIX", "Destination Secret name suffix in Secret Receiver")
+	config.StringEnvVar(verifyCmd.Flags(), &config.KeyNameSuffix, "keyNameSuffix", "KEY_NAME_SUFFIX", "Key inside Secret to be used as value in new secret, with subvalue")
+	config.StringEnvVar(verifyCmd.Flags(), &config.MatchKey, "matchKey", "MATCH_KEY", "Key inside Secret exported to Secret Receiver, with subvalue")
+	config.StringEnvVar(verifyCmd.Flags(), &config.NewLabels, "newLabels", "NEW_LABELS", "New Labels exported to Secret Receiver, with subvalue")
+	config.StringEnvVar(verifyCmd.Flags(), &config.NewAnnotations, "newAnnotations", "NEW_ANNOTATIONS", "New Annotations exported to Secret Receiver, with subvalue")
+	config.StringEnvVar(verifyCmd.Flags(), &config.DisabledLabel, "disabledLabel", "DISABLED_LABEL", "Label of secrets not exported to Secret Receiver, with subvalue")
+	config.StringEnvVar(verifyCmd.Flags(), &config.MiddleName, "middleName", "MIDDLE_NAME", "Middle name in secret data name sent to Secret Receiver, with subvalue")
+	config.StringEnvVarP(applyCmd.Flags(), &config.ApplyFile, "filename", "f", "APPLY_FILE", "YAML or JSON file with one or more secrets, use - to read from stdin")
+	config.StringEnvVar(applyCmd.Flags(), &config.SecretNamespace, "secretNamespace", "SECRET_NAMESPACE", "Default Secret namespace for entries without namespace")
+	rotateKeyCmd.Flags().DurationVar(&config.KeyActivateIn, "activateIn", 0, "wait before signing with the new key, so Secret Receiver loads it first")
+	rotateKeyCmd.Flags().DurationVar(&config.KeyGracePeriod, "gracePeriod", 24*time.Hour, "time the other keys stay valid after the new key is active")
+	rotateKeyCmd.Flags().BoolVar(&config.DryRun, "dry-run", false, "print the new keyring without saving it")
+	configCmd.AddCommand(configViewCmd)
+	config.StringEnvVar(mockReceiverCmd.Flags(), &config.MockListen, "listen", "MOCK_LISTEN", "address to listen on (default :8080), use MOCK_LISTEN environment variable")
+	config.DurationEnvVar(mockReceiverCmd.Flags(), &config.MockLatency, "latency", "MOCK_LATENCY", 0, "added before every response, use MOCK_LATENCY environment variable")
+	config.IntEnvVar(mockReceiverCmd.Flags(), &config.MockFailFirst, "failFirst", "MOCK_FAIL_FIRST", 0, "answer the first requests with --failureStatus, use MOCK_FAIL_FIRST environment variable")
+	config.Float64EnvVar(mockReceiverCmd.Flags(), &config.MockFailureRate, "failureRate", "MOCK_FAILURE_RATE", 0, "fraction of requests, from 0 to 1, answered with --failureStatus, use MOCK_FAILURE_RATE environment variable")
+	config.IntEnvVar(mockReceiverCmd.Flags(), &config.MockFailureStatus, "failureStatus", "MOCK_FAILURE_STATUS", 503, "status of injected failures, use MOCK_FAILURE_STATUS environment variable")
+	config.StringSliceEnvVar(mockReceiverCmd.Flags(), &config.PublicKeyFiles, "publicKeyFile", "PUBLIC_KEY_FILE", "PEM Ed25519 public keys accepted, the key id is the public key fingerprint, use PUBLIC_KEY_FILE environment variable")
+	keygenCmd.Flags().StringVar(&config.KeyType, "keyType", "ed25519", "ed25519 to sign requests or x25519 to encrypt secret data")
+	decryptCmd.Flags().StringVarP(&config.InputFile, "filename", "f", "-", "JSON or YAML secret with encrypted data, - reads stdin")
+	config.StringEnvVar(decryptCmd.Flags(), &config.DecryptionKeyFile, "decryptionKeyFile", "DECRYPTION_KEY_FILE", "PEM X25519 private key, use DECRYPTION_KEY_FILE environment variable")
+	for _, cmd := range []*cobra.Command{existCmd, deleteCmd, scanSecretsCmd, scanCMCmd, scanSecretsValuesCmd, applyCmd} {
+		cmd.Flags().BoolVar(&config.DryRun, "dry-run", false, "print the plan without sending anything to Secret Receiver")
+	}
+	for _, cmd := range []*cobra.Command{scanSecretsCmd, scanCMCmd, scanSecretsValuesCmd, diffScanSecretsCmd, diffScanCMCmd, diffSecretsValuesCmd, applyCmd, verifyCmd} {
+		config.IntEnvVar(cmd.Flags(), &config.Concurrency, "concurrency", "CONCURRENCY", 1, "secrets processed at the same time, 0 means 1, use CONCURRENCY environment variable")
+	}
+	for _, cmd := range []*cobra.Command{scanSecretsCmd, scanCMCmd, scanSecretsValuesCmd} {
+		config.BoolEnvVar(cmd.Flags(), &config.Watch, "watch", "WATCH", "keep running and send changes as they happen, use WATCH environment variable")
+		config.DurationEnvVar(cmd.Flags(), &config.ResyncPeriod, "resync", "RESYNC_PERIOD", 10*time.Minute, "period to check all items again in watch mode, use RESYNC_PERIOD environment variable")
+		cmd.Flags().IntVar(&config.WatchMaxRetries, "maxRetries", 5, "retries with rate limit for one item in watch mode")
+	}
+	for _, cmd := range []*cobra.Command{scanSecretsCmd, scanCMCmd, scanSecretsValuesCmd, diffScanSecretsCmd, diffScanCMCmd, diffSecretsValuesCmd} {
+		config.BoolEnvVar(cmd.Flags(), &config.Prune, "prune", "PRUNE", "delete from Secret Receiver the secrets sent before whose source was removed, use PRUNE environment variable")
+		config.StringEnvVar(cmd.Flags(), &config.PublisherID, "publisherID", "PUBLISHER_ID", "identifies this publisher in the owner label added to secrets, needed by --prune, use PUBLISHER_ID environment variable")
+		config.StringEnvVar(cmd.Flags(), &config.InventoryName, "inventoryName", "INVENTORY_NAME", "config map in --secretNamespace with secrets sent by this publisher (default secretpublisher-PUBLISHER_ID), use INVENTORY_NAME environment variable")
+	}
+}
+
+// singleReport func returns a report for commands with one secret
+func singleReport(result *domain.Result) *domain.Report {
+	return &domain.Report{Results: []*domain.Result{result}}
+}
+
+// render func prints report in config.Output and exits with 2 when err is not nil.
+// In text mode it prints the report message, only when there is no error.
+func render(report *domain.Report, err error) {
+	if report != nil {
+		if utils.Structured() {
+			utils.PrintReport(os.Stdout, config.Output, report)
+		} else if err == nil {
+			fmt.Printf("%s", report.Message)
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(utils.Out(), "%v", err)
+		if errors.Is(err, domain.ErrDrift) {
+			os.Exit(3)
+		}
+		os.Exit(2)
+	}
+}
+
+// initialize func validates the configuration after flags are parsed and creates the repository
+func initialize(cmd *cobra.Command, args []string) error {
+	if err := config.LoadProfile(cmd); err != nil {
+		return err
+	}
+	if err := config.Validate(cmd); err != nil {
+		return err
+	}
+	if err := usecase.LoadStringData(); err != nil {
+		return err
+	}
+	if !config.NeedsReceiver(cmd) || config.TestRun == "true" {
+		return nil
+	}
+	keyring, err := usecase.LoadKeyring()
+	if err != nil {
+		return err
+	}
+	if err := usecase.LoadEncryptionKey(); err != nil {
+		return err
+	}
+	receivers, err := usecase.LoadReceivers()
+	if err != nil {
+		return err
+	}
+	var repo domain.Repository
+	if receivers != nil {
+		repo, err = backend.NewFanout(receivers, backend.Options{Keyring: keyring})
+	} else {
+		repo, err = backend.NewRepository(config.ReceiverURL, backend.Options{Keyring: keyring})
+	}
+	if err != nil {
+		return err
+	}
+	appcontext.Current.Add(appcontext.Repository, repo)
+	if config.Debug {
+		fmt.Fprintln(utils.Out(), "[INFO] Using Repository")
+	}
+	return nil
 }
 
 func main() {
 	rootCmd := config.ConfigureRootCommand()
+	rootCmd.PersistentPreRunE = initialize
 	initCommands()
-	rootCmd.AddCommand(versionCmd, existCmd, createCmd, updateCmd, checkCmd, deleteCmd, scanSecretsCmd, scanCMCmd, scanSecretsValuesCmd)
-	if err := rootCmd.Execute(); err != nil {
+	rootCmd.AddCommand(versionCmd, existCmd, diffCmd, createCmd, updateCmd, checkCmd, deleteCmd, scanSecretsCmd, scanCMCmd, scanSecretsValuesCmd, verifyCmd, applyCmd, rotateKeyCmd, keygenCmd, decryptCmd, configCmd, mockReceiverCmd)
+	// commands stop sending requests on SIGTERM or SIGINT, a second signal exits at once
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "[ERROR]: %v\n", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,297 @@
+// Package mockreceiver implements the Secret Receiver API in memory, to run secretpublisher
+// end to end without a cluster. Server is an http.Handler, so it works with httptest.NewServer.
+package mockreceiver
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/betorvs/secretpublisher/domain"
+)
+
+// Options configures the signatures accepted and the faults injected by Server
+type Options struct {
+	// EncodingRequest is the HMAC key, requests are not verified when it is empty or disabled
+	// and there is no Keyring or PublicKeys
+	EncodingRequest string
+	// Keyring has HMAC keys chosen by X-SECRET-Key-ID
+	Keyring *domain.Keyring
+	// PublicKeys has Ed25519 public keys by key id
+	PublicKeys map[string]ed25519.PublicKey
+	// MaxClockSkew rejects timestamps older or newer than it, 5 minutes when zero
+	MaxClockSkew time.Duration
+	// Latency is added before every response
+	Latency time.Duration
+	// FailFirst answers the first requests with FailureStatus
+	FailFirst int
+	// FailureRate answers this fraction of requests, from 0 to 1, with FailureStatus
+	FailureRate float64
+	// FailureStatus is 503 when zero
+	FailureStatus int
+	// RetryAfter is sent in Retry-After with failures when not zero
+	RetryAfter time.Duration
+	// Log receives one line per request when not nil
+	Log io.Writer
+}
+
+// Server struct keeps secrets by namespace/name
+type Server struct {
+	options  Options
+	mu       sync.Mutex
+	secrets  map[string]*domain.Secret
+	nonces   map[string]bool
+	replies  map[string]int
+	requests int
+	random   *rand.Rand
+}
+
+// New func returns a Server with no secrets
+func New(options Options) *Server {
+	if options.MaxClockSkew == 0 {
+		options.MaxClockSkew = 5 * time.Minute
+	}
+	if options.FailureStatus == 0 {
+		options.FailureStatus = http.StatusServiceUnavailable
+	}
+	return &Server{
+		options: options,
+		secrets: make(map[string]*domain.Secret),
+		nonces:  make(map[string]bool),
+		replies: make(map[string]int),
+		random:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Secret func returns a copy of the secret namespace/name, nil when it does not exist
+func (s *Server) Secret(namespace, name string) *domain.Secret {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secret, ok := s.secrets[namespace+"/"+name]
+	if !ok {
+		return nil
+	}
+	copied := *secret
+	return &copied
+}
+
+// Len func returns how many secrets the server has
+func (s *Server) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.secrets)
+}
+
+// Requests func returns how many requests the server received, with the failed ones
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// ServeHTTP func answers GET and DELETE in any path ending with /NAMESPACE/NAME and POST and
+// PUT with the secret in the body, like Secret Receiver
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	status := s.serve(w, r)
+	if s.options.Log != nil {
+		fmt.Fprintf(s.options.Log, "[MOCK] %s %s %d\n", r.Method, r.URL.Path, status)
+	}
+}
+
+// serve func writes the response and returns its status
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) int {
+	if s.options.Latency > 0 {
+		select {
+		case <-r.Context().Done():
+			return 0
+		case <-time.After(s.options.Latency):
+		}
+	}
+	if s.fail() {
+		if s.options.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(s.options.RetryAfter.Seconds())))
+		}
+		w.WriteHeader(s.options.FailureStatus)
+		return s.options.FailureStatus
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return reply(w, http.StatusBadRequest, nil)
+	}
+	var namespace, name string
+	var secret *domain.Secret
+	switch r.Method {
+	case http.MethodGet, http.MethodDelete:
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) < 2 {
+			return reply(w, http.StatusBadRequest, nil)
+		}
+		namespace, name = parts[len(parts)-2], parts[len(parts)-1]
+	case http.MethodPost, http.MethodPut:
+		secret = &domain.Secret{}
+		if err := json.Unmarshal(body, secret); err != nil || secret.Name == "" || secret.Namespace == "" {
+			return reply(w, http.StatusBadRequest, nil)
+		}
+		namespace, name = secret.Namespace, secret.Name
+	default:
+		return reply(w, http.StatusMethodNotAllowed, nil)
+	}
+	if err := s.verify(r, name, namespace, body); err != nil {
+		return reply(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+	}
+	return s.store(w, r, namespace+"/"+name, secret)
+}
+
+// store func applies the request to the secrets
+func (s *Server) store(w http.ResponseWriter, r *http.Request, key string, secret *domain.Secret) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, found := s.secrets[key]
+	switch r.Method {
+	case http.MethodGet:
+		if !found {
+			return reply(w, http.StatusNotFound, nil)
+		}
+		return reply(w, http.StatusOK, current)
+	case http.MethodDelete:
+		if !found {
+			return reply(w, http.StatusNotFound, nil)
+		}
+		delete(s.secrets, key)
+		return reply(w, http.StatusOK, nil)
+	case http.MethodPost:
+		// a retried POST with the same Idempotency-Key gets the first answer
+		idempotencyKey := r.Header.Get("Idempotency-Key")
+		if status, ok := s.replies[idempotencyKey]; ok && idempotencyKey != "" {
+			return reply(w, status, nil)
+		}
+		status := http.StatusCreated
+		if found {
+			status = http.StatusConflict
+		} else {
+			s.secrets[key] = secret
+		}
+		if idempotencyKey != "" {
+			s.replies[idempotencyKey] = status
+		}
+		return reply(w, status, nil)
+	}
+	if !found {
+		return reply(w, http.StatusNotFound, nil)
+	}
+	s.secrets[key] = secret
+	return reply(w, http.StatusOK, nil)
+}
+
+// fail func returns true when the request must fail with Options.FailureStatus
+func (s *Server) fail() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if s.requests <= s.options.FailFirst {
+		return true
+	}
+	return s.options.FailureRate > 0 && s.random.Float64() < s.options.FailureRate
+}
+
+// verify func checks the request signatures with the options, v2 too when it was sent
+func (s *Server) verify(r *http.Request, name, namespace string, body []byte) error {
+	verifier, err := s.verifier(r.Header.Get("X-SECRET-Key-ID"))
+	if err != nil || verifier == nil {
+		return err
+	}
+	timestamp := r.Header.Get("X-SECRET-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid X-SECRET-Request-Timestamp")
+	}
+	if skew := time.Since(time.Unix(seconds, 0)); skew > s.options.MaxClockSkew || skew < -s.options.MaxClockSkew {
+		return fmt.Errorf("X-SECRET-Request-Timestamp is too old or in the future")
+	}
+	if !verifier(fmt.Sprintf("v1:%s:%s", timestamp, name), r.Header.Get("X-SECRET-Signature")) {
+		return fmt.Errorf("invalid X-SECRET-Signature")
+	}
+	if r.Header.Get("X-SECRET-Signature-Version") != "v2" {
+		// a v1 Ed25519 signature does not cover the body, it could be replayed
+		if _, ok := s.options.PublicKeys[r.Header.Get("X-SECRET-Key-ID")]; ok {
+			return fmt.Errorf("Ed25519 signatures need X-SECRET-Signature-V2")
+		}
+		return nil
+	}
+	sum := sha256.Sum256(body)
+	bodyHash := hex.EncodeToString(sum[:])
+	if r.Header.Get("X-SECRET-Content-SHA256") != bodyHash {
+		return fmt.Errorf("X-SECRET-Content-SHA256 does not match the body")
+	}
+	nonce := r.Header.Get("X-SECRET-Nonce")
+	message := fmt.Sprintf("v2\n%s\n%s\n%s\n%s\n%s\n%s", timestamp, nonce, r.Method, r.URL.EscapedPath(), namespace, bodyHash)
+	if nonce == "" || !verifier(message, r.Header.Get("X-SECRET-Signature-V2")) {
+		return fmt.Errorf("invalid X-SECRET-Signature-V2")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.nonces[nonce] {
+		return fmt.Errorf("X-SECRET-Nonce was already used")
+	}
+	s.nonces[nonce] = true
+	return nil
+}
+
+// verifier func returns the func that checks a signature for keyID, nil when requests are not verified
+func (s *Server) verifier(keyID string) (func(message, signature string) bool, error) {
+	if public, ok := s.options.PublicKeys[keyID]; ok {
+		return func(message, signature string) bool {
+			decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(signature, "ed25519="))
+			return err == nil && strings.HasPrefix(signature, "ed25519=") && ed25519.Verify(public, []byte(message), decoded)
+		}, nil
+	}
+	if s.options.Keyring != nil {
+		for _, key := range s.options.Keyring.Keys {
+			if key.ID == keyID && key.Valid(time.Now()) {
+				return hmacVerifier(key.Secret), nil
+			}
+		}
+		return nil, fmt.Errorf("unknown or expired key %q", keyID)
+	}
+	if len(s.options.PublicKeys) > 0 {
+		return nil, fmt.Errorf("unknown key %q", keyID)
+	}
+	if s.options.EncodingRequest == "" || s.options.EncodingRequest == "disabled" {
+		return nil, nil
+	}
+	return hmacVerifier(s.options.EncodingRequest), nil
+}
+
+// hmacVerifier func checks v0= HMAC-SHA256 signatures with key
+func hmacVerifier(key string) func(message, signature string) bool {
+	return func(message, signature string) bool {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write([]byte(message))
+		expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+		return hmac.Equal([]byte(expected), []byte(signature))
+	}
+}
+
+// reply func writes status and body as JSON when it is not nil
+func reply(w http.ResponseWriter, status int, body interface{}) int {
+	if body == nil {
+		w.WriteHeader(status)
+		return status
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+	return status
+}
@@ -0,0 +1,119 @@
+package mockreceiver
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	gateway "github.com/betorvs/secretpublisher/gateway/secret"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRepository(server *httptest.Server) gateway.Repository {
+	return gateway.Repository{Client: server.Client(), URL: server.URL + "/secret", Retries: &gateway.RetryCounter{}}
+}
+
+func TestServer(t *testing.T) {
+	config.SigningVersion = "v2"
+	config.RetryWait = time.Millisecond
+	defer func() { config.SigningVersion, config.RetryWait = "", 0 }()
+	mock := New(Options{EncodingRequest: "shared"})
+	server := httptest.NewServer(mock)
+	defer server.Close()
+	repo := newRepository(server)
+	repo.EncodingRequest = "shared"
+	ctx := context.Background()
+	secret := &domain.Secret{Name: "foo", Namespace: "default", Checksum: "abc", Data: map[string]string{"user": "admin"}}
+
+	status, err := repo.GetSecret(ctx, "foo", "default")
+	assert.NoError(t, err)
+	assert.False(t, status.Found)
+	assert.NoError(t, repo.CreateSecret(ctx, secret))
+	assert.True(t, errors.Is(repo.CreateSecret(ctx, secret), domain.ErrConflict))
+	status, err = repo.GetSecret(ctx, "foo", "default")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", status.Checksum)
+	assert.Equal(t, "admin", status.Secret.Data["user"])
+
+	secret.Checksum = "def"
+	assert.NoError(t, repo.UpdateSecret(ctx, secret))
+	assert.Equal(t, "def", mock.Secret("default", "foo").Checksum)
+	assert.NoError(t, repo.DeleteSecret(ctx, "foo", "default"))
+	assert.True(t, errors.Is(repo.DeleteSecret(ctx, "foo", "default"), domain.ErrNotFound))
+	assert.True(t, errors.Is(repo.UpdateSecret(ctx, secret), domain.ErrNotFound))
+	assert.Equal(t, 0, mock.Len())
+
+	repo.EncodingRequest = "wrong"
+	_, err = repo.GetSecret(ctx, "foo", "default")
+	assert.True(t, errors.Is(err, domain.ErrUnauthorized))
+}
+
+func TestServerKeys(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	keyring := &domain.Keyring{Keys: []*domain.SigningKey{{ID: "k1", Secret: "one"}}}
+	server := httptest.NewServer(New(Options{Keyring: keyring, PublicKeys: map[string]ed25519.PublicKey{"publisher-a": public}}))
+	defer server.Close()
+	ctx := context.Background()
+
+	repo := newRepository(server)
+	repo.Keyring = keyring
+	_, err = repo.GetSecret(ctx, "foo", "default")
+	assert.NoError(t, err)
+
+	repo = newRepository(server)
+	repo.PrivateKey = &gateway.Ed25519Key{ID: "publisher-a", Key: private}
+	_, err = repo.GetSecret(ctx, "foo", "default")
+	assert.NoError(t, err)
+
+	repo.PrivateKey.ID = "publisher-b"
+	_, err = repo.GetSecret(ctx, "foo", "default")
+	assert.True(t, errors.Is(err, domain.ErrUnauthorized))
+
+	// a v1 signature alone could be replayed with another body
+	timestamp := fmt.Sprintf("%d", time.Now().Unix())
+	req, _ := http.NewRequest("GET", server.URL+"/secret/default/foo", nil)
+	req.Header.Set("X-SECRET-Key-ID", "publisher-a")
+	req.Header.Set("X-SECRET-Request-Timestamp", timestamp)
+	req.Header.Set("X-SECRET-Signature", "ed25519="+base64.StdEncoding.EncodeToString(ed25519.Sign(private, []byte("v1:"+timestamp+":foo"))))
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestServerFaults(t *testing.T) {
+	config.Retries, config.RetryWait, config.RetryPost = 2, time.Millisecond, true
+	defer func() { config.Retries, config.RetryWait, config.RetryPost = 0, 0, false }()
+	mock := New(Options{FailFirst: 2})
+	server := httptest.NewServer(mock)
+	defer server.Close()
+	repo := newRepository(server)
+	ctx := context.Background()
+
+	assert.NoError(t, repo.CreateSecret(ctx, &domain.Secret{Name: "foo", Namespace: "default"}))
+	assert.Equal(t, int64(2), repo.RetryCount())
+	assert.Equal(t, 3, mock.Requests())
+
+	mock = New(Options{FailureRate: 1, FailureStatus: http.StatusBadGateway})
+	server2 := httptest.NewServer(mock)
+	defer server2.Close()
+	_, err := newRepository(server2).GetSecret(ctx, "foo", "default")
+	assert.True(t, errors.Is(err, domain.ErrServer))
+
+	server3 := httptest.NewServer(New(Options{Latency: time.Second}))
+	defer server3.Close()
+	timeout, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	config.Retries = 0
+	_, err = newRepository(server3).GetSecret(timeout, "foo", "default")
+	assert.Error(t, err)
+}
@@ -0,0 +1,122 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/betorvs/secretpublisher/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// ApplySecrets func reads a manifest file with many secrets and creates, updates or skips each one
+func ApplySecrets(ctx context.Context, filename string) (*domain.Report, error) {
+	secrets, err := ReadSecretsFile(filename)
+	if err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
+	retries := retryCount()
+	if len(secrets) == 0 {
+		return newReport(fmt.Sprintf("Secrets not found in %s\n", filename), nil, retries), nil
+	}
+	var summary strings.Builder
+	counts := make(map[string]int)
+	var countErrorsNames []string
+	results, errs := manageSecrets(ctx, secrets)
+	for i, secret := range secrets {
+		action, err := results[i].Action, errs[i]
+		counts[action]++
+		if err != nil {
+			countErrorsNames = append(countErrorsNames, secret.Name)
+			fmt.Fprintf(&summary, "%s/%s: %s (%v)\n", secret.Namespace, secret.Name, action, err)
+			continue
+		}
+		fmt.Fprintf(&summary, "%s/%s: %s\n", secret.Namespace, secret.Name, action)
+	}
+	if config.DryRun {
+		fmt.Fprintf(&summary, "Plan for %d secrets: %d to create, %d to update, %d unchanged, %d failed\n", len(secrets), counts[domain.ActionCreated], counts[domain.ActionUpdated], counts[domain.ActionUnchanged], counts[domain.ActionFailed])
+	} else {
+		fmt.Fprintf(&summary, "Applied %d secrets: %d created, %d updated, %d unchanged, %d failed\n", len(secrets), counts[domain.ActionCreated], counts[domain.ActionUpdated], counts[domain.ActionUnchanged], counts[domain.ActionFailed])
+	}
+	report := newReport("", results, retries)
+	if report.Retries > 0 {
+		fmt.Fprintf(&summary, "Retried %d requests to Secret Receiver\n", report.Retries)
+	}
+	report.Message = summary.String()
+	if len(countErrorsNames) != 0 {
+		return report, fmt.Errorf("Cannot process these secrets: %v", countErrorsNames)
+	}
+	return report, nil
+}
+
+// ReadSecretsFile func parses a multi-document YAML or JSON file into secrets.
+// Use "-" as filename to read from stdin.
+func ReadSecretsFile(filename string) ([]*domain.Secret, error) {
+	content, err := readInput(filename)
+	if err != nil {
+		return nil, err
+	}
+	return parseSecrets(content)
+}
+
+// readInput func reads filename, or stdin when it is -
+func readInput(filename string) ([]byte, error) {
+	if filename == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(filename)
+}
+
+// parseSecrets func decodes every document and fills defaults and checksum
+func parseSecrets(content []byte) ([]*domain.Secret, error) {
+	var secrets []*domain.Secret
+	seen := make(map[string]bool)
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	for doc := 1; ; doc++ {
+		secret := &domain.Secret{}
+		err := decoder.Decode(secret)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %v", doc, err)
+		}
+		if secret.Name == "" && len(secret.Data) == 0 && len(secret.BinaryData) == 0 {
+			// empty document, like a trailing ---
+			continue
+		}
+		if secret.Name == "" {
+			return nil, fmt.Errorf("document %d: name is empty", doc)
+		}
+		if secret.Namespace == "" {
+			secret.Namespace = config.SecretNamespace
+		}
+		key := fmt.Sprintf("%s/%s", secret.Namespace, secret.Name)
+		if seen[key] {
+			return nil, fmt.Errorf("document %d: secret %s is duplicated", doc, key)
+		}
+		seen[key] = true
+		if _, err := secret.RawData(); err != nil {
+			return nil, fmt.Errorf("document %d: %v", doc, err)
+		}
+		applied := rewriteSecret(&domain.Secret{
+			Name:        secret.Name,
+			Namespace:   secret.Namespace,
+			Type:        secret.Type,
+			Immutable:   secret.Immutable,
+			Data:        secret.Data,
+			BinaryData:  secret.BinaryData,
+			Labels:      secret.Labels,
+			Annotations: secret.Annotations,
+		})
+		secrets = append(secrets, applied)
+	}
+	return secrets, nil
+}
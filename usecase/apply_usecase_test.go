@@ -0,0 +1,64 @@
+package usecase
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/betorvs/secretpublisher/appcontext"
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSecrets(t *testing.T) {
+	config.SecretNamespace = "default"
+	content := []byte(`name: foo
+data:
+  user: admin
+  port: 5432
+labels:
+  app: foo
+---
+{"name": "bar", "namespace": "other", "data": {"password": "a=b"}}
+---
+`)
+	secrets, err := parseSecrets(content)
+	assert.NoError(t, err)
+	assert.Len(t, secrets, 2)
+	assert.Equal(t, "default", secrets[0].Namespace)
+	assert.Equal(t, "5432", secrets[0].Data["port"])
+	assert.Equal(t, "foo", secrets[0].Labels["app"])
+	assert.NotEmpty(t, secrets[0].Checksum)
+	assert.Equal(t, "other", secrets[1].Namespace)
+	assert.Equal(t, "a=b", secrets[1].Data["password"])
+
+	_, err = parseSecrets([]byte("data:\n  user: admin\n"))
+	assert.Error(t, err)
+	_, err = parseSecrets([]byte("name: foo\n---\nname: foo\n"))
+	assert.Error(t, err)
+
+	secrets, err = parseSecrets([]byte("name: tls\ntype: kubernetes.io/tls\nimmutable: true\nbinaryData:\n  keystore: /wD+\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, "kubernetes.io/tls", secrets[0].Type)
+	assert.True(t, secrets[0].Immutable)
+	assert.Equal(t, "/wD+", secrets[0].BinaryData["keystore"])
+	_, err = parseSecrets([]byte("name: foo\nbinaryData:\n  keystore: not base64\n"))
+	assert.Error(t, err)
+}
+
+func TestApplySecrets(t *testing.T) {
+	defer keepRepositoryCalls()()
+	repo := RepositoryMock{}
+	appcontext.Current.Add(appcontext.Repository, repo)
+	file, err := ioutil.TempFile("", "apply-*.yaml")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString("name: foo\ndata:\n  user: admin\n---\nname: bar\ndata:\n  user: root\n")
+	assert.NoError(t, err)
+	file.Close()
+	res, err := ApplySecrets(context.Background(), file.Name())
+	assert.NoError(t, err)
+	assert.Contains(t, res.Message, "2 created")
+	assert.Len(t, res.Results, 2)
+}
@@ -0,0 +1,125 @@
+package usecase
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+)
+
+const (
+	// checksumV1 is the legacy checksum: sha512 of all values concatenated in key order
+	checksumV1 = "v1"
+	// checksumV2 is the canonical checksum: sha512 of sorted key names and values,
+	// optionally with labels and annotations, prefixed with "v2:"
+	checksumV2 = "v2"
+	// secretTypeOpaque is the default kubernetes secret type
+	secretTypeOpaque = "Opaque"
+)
+
+// setChecksum func fills Checksum and ChecksumVersion using config.ChecksumVersion
+func setChecksum(secret *domain.Secret) {
+	version := checksumVersion(config.ChecksumVersion)
+	secret.ChecksumVersion = version
+	secret.Checksum = secretChecksum(version, secret)
+}
+
+// checksumVersion func returns a known checksum version, v1 is the default
+func checksumVersion(version string) string {
+	if version == checksumV2 {
+		return checksumV2
+	}
+	return checksumV1
+}
+
+// secretChecksum func calculates the secret checksum in one version, over the raw bytes of
+// Data and BinaryData. Version v2 includes the type, when it is not Opaque, and immutable.
+func secretChecksum(version string, secret *domain.Secret) string {
+	data := plainData(secret)
+	if version != checksumV2 {
+		var values strings.Builder
+		for _, k := range sortedKeys(data) {
+			values.WriteString(data[k])
+		}
+		return createCheckSum(values.String())
+	}
+	var canonical strings.Builder
+	writeCanonicalMap(&canonical, "data", data)
+	if secret.Type != "" && secret.Type != secretTypeOpaque {
+		fmt.Fprintf(&canonical, "type:%d:%s\n", len(secret.Type), secret.Type)
+	}
+	if secret.Immutable {
+		canonical.WriteString("immutable\n")
+	}
+	if config.ChecksumMetadata {
+		writeCanonicalMap(&canonical, "labels", secret.Labels)
+		writeCanonicalMap(&canonical, "annotations", secret.Annotations)
+	}
+	return fmt.Sprintf("%s:%s", checksumV2, createCheckSum(canonical.String()))
+}
+
+// plainData func returns Data with the decoded BinaryData, so the checksum of a value does not
+// depend on where it is. Invalid BinaryData is used as it is.
+func plainData(secret *domain.Secret) map[string]string {
+	if len(secret.BinaryData) == 0 {
+		return secret.Data
+	}
+	data := make(map[string]string, len(secret.Data)+len(secret.BinaryData))
+	raw, err := secret.RawData()
+	if err != nil {
+		for k, v := range secret.BinaryData {
+			data[k] = v
+		}
+		for k, v := range secret.Data {
+			data[k] = v
+		}
+		return data
+	}
+	for k, v := range raw {
+		data[k] = string(v)
+	}
+	return data
+}
+
+// checksumMatches func returns true when the checksum stored in Secret Receiver is the secret checksum
+func checksumMatches(remote string, secret *domain.Secret) bool {
+	return remote == secret.Checksum
+}
+
+// checksumMigrates func returns true when the checksum stored in Secret Receiver uses another
+// version and matches the secret in that version. It is not in sync: v1 ignores key names, so
+// renamed or swapped keys match too. The secret is sent once more to store its checksum.
+func checksumMigrates(remote string, secret *domain.Secret) bool {
+	if remote == secret.Checksum {
+		return false
+	}
+	remoteVersion := checksumV1
+	if strings.HasPrefix(remote, checksumV2+":") {
+		remoteVersion = checksumV2
+	}
+	if remoteVersion == checksumVersion(secret.ChecksumVersion) {
+		return false
+	}
+	return remote == secretChecksum(remoteVersion, secret)
+}
+
+// writeCanonicalMap func writes a map with length prefixed and sorted entries,
+// so separators inside keys or values cannot produce the same output
+func writeCanonicalMap(b *strings.Builder, section string, m map[string]string) {
+	fmt.Fprintf(b, "%s:%d\n", section, len(m))
+	for _, k := range sortedKeys(m) {
+		fmt.Fprintf(b, "%d:%s=%d:%s\n", len(k), k, len(m[k]), m[k])
+	}
+}
+
+// sortedKeys func returns map keys in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,76 @@
+package usecase
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretChecksumV1(t *testing.T) {
+	secret := &domain.Secret{Data: map[string]string{"b": "lue", "a": "va"}}
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, createCheckSum("value"), secretChecksum(checksumV1, secret))
+	}
+}
+
+func TestSecretChecksumV2(t *testing.T) {
+	defer func() { config.ChecksumMetadata = false }()
+	secret := &domain.Secret{Data: map[string]string{"user": "admin"}, Labels: map[string]string{"app": "foo"}}
+	renamed := &domain.Secret{Data: map[string]string{"username": "admin"}, Labels: map[string]string{"app": "bar"}}
+	test := secretChecksum(checksumV2, secret)
+	assert.True(t, strings.HasPrefix(test, "v2:"))
+	assert.NotEqual(t, test, secretChecksum(checksumV2, renamed))
+	assert.Equal(t, secretChecksum(checksumV1, secret), secretChecksum(checksumV1, renamed))
+	// labels are ignored without metadata
+	relabeled := &domain.Secret{Data: secret.Data, Labels: map[string]string{"app": "bar"}}
+	assert.Equal(t, test, secretChecksum(checksumV2, relabeled))
+	config.ChecksumMetadata = true
+	assert.NotEqual(t, secretChecksum(checksumV2, secret), secretChecksum(checksumV2, relabeled))
+	// separators inside values do not collide
+	a := &domain.Secret{Data: map[string]string{"a": "b\n1:c=1:d"}}
+	b := &domain.Secret{Data: map[string]string{"a": "b", "c": "d"}}
+	assert.NotEqual(t, secretChecksum(checksumV2, a), secretChecksum(checksumV2, b))
+}
+
+func TestChecksumMatches(t *testing.T) {
+	defer func() { config.ChecksumVersion = "" }()
+	config.ChecksumVersion = checksumV2
+	secret := &domain.Secret{Data: map[string]string{"user": "admin"}}
+	setChecksum(secret)
+	assert.Equal(t, checksumV2, secret.ChecksumVersion)
+	assert.True(t, checksumMatches(secret.Checksum, secret))
+	assert.False(t, checksumMigrates(secret.Checksum, secret))
+	// stored by an older publisher using v1, sent again to store v2
+	assert.False(t, checksumMatches(createCheckSum("admin"), secret))
+	assert.True(t, checksumMigrates(createCheckSum("admin"), secret))
+	assert.False(t, checksumMigrates(createCheckSum("root"), secret))
+	assert.False(t, checksumMigrates("v2:abc", secret))
+	// v1 ignores key names
+	renamed := &domain.Secret{Data: map[string]string{"username": "admin"}}
+	setChecksum(renamed)
+	assert.False(t, checksumMatches(secretChecksum(checksumV1, secret), renamed))
+}
+
+func TestSecretChecksumBinaryData(t *testing.T) {
+	raw := []byte{0xff, 0x00, 0xfe}
+	binary := &domain.Secret{BinaryData: map[string]string{"keystore": base64.StdEncoding.EncodeToString(raw)}}
+	text := &domain.Secret{Data: map[string]string{"keystore": string(raw)}}
+	for _, version := range []string{checksumV1, checksumV2} {
+		assert.Equal(t, secretChecksum(version, text), secretChecksum(version, binary), version)
+	}
+	assert.Equal(t, createCheckSum(string(raw)), secretChecksum(checksumV1, binary))
+
+	// type and immutable change only v2, Opaque is the default type
+	secret := &domain.Secret{Data: map[string]string{"tls.crt": "cert"}}
+	typed := &domain.Secret{Data: secret.Data, Type: "kubernetes.io/tls"}
+	opaque := &domain.Secret{Data: secret.Data, Type: "Opaque"}
+	immutable := &domain.Secret{Data: secret.Data, Immutable: true}
+	assert.Equal(t, secretChecksum(checksumV1, secret), secretChecksum(checksumV1, typed))
+	assert.NotEqual(t, secretChecksum(checksumV2, secret), secretChecksum(checksumV2, typed))
+	assert.Equal(t, secretChecksum(checksumV2, secret), secretChecksum(checksumV2, opaque))
+	assert.NotEqual(t, secretChecksum(checksumV2, secret), secretChecksum(checksumV2, immutable))
+}
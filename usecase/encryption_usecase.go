@@ -0,0 +1,298 @@
+package usecase
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/betorvs/secretpublisher/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// encryptionAlgorithm is X25519 key agreement with an ephemeral key, SHA-256 key derivation
+// and AES-256-GCM, with namespace/name as additional data
+const encryptionAlgorithm = "x25519-aes256gcm"
+
+// encryptionKey is the Secret Receiver public key loaded by LoadEncryptionKey, nil sends Data in clear
+var encryptionKey *recipientKey
+
+// checksumKey is the HMAC key of checksums loaded by LoadEncryptionKey, nil uses plain sha512
+var checksumKey []byte
+
+// minChecksumKeySize is the minimum checksum key length in bytes
+const minChecksumKeySize = 32
+
+// recipientKey is a public key with its key id
+type recipientKey struct {
+	id  string
+	key *ecdh.PublicKey
+}
+
+// LoadEncryptionKey func reads the X25519 public key in config.EncryptionKeyFile, then
+// CreateSecret and UpdateSecret encrypt Data to it, and the key in config.ChecksumKeyFile, then
+// checksums are HMAC-SHA512, so Secret Receiver and anyone reading requests cannot guess
+// the encrypted data from the checksum. It does nothing when the files are not set.
+func LoadEncryptionKey() error {
+	checksumKey = nil
+	if config.ChecksumKeyFile != "" {
+		content, err := ioutil.ReadFile(config.ChecksumKeyFile)
+		if err != nil {
+			return utils.ErrorHandler(err)
+		}
+		key := bytes.TrimSpace(content)
+		if len(key) < minChecksumKeySize {
+			return utils.ErrorHandler(fmt.Errorf("%s: checksum key must have at least %d bytes", config.ChecksumKeyFile, minChecksumKeySize))
+		}
+		checksumKey = key
+	}
+	if config.EncryptionKeyFile == "" {
+		encryptionKey = nil
+		return nil
+	}
+	content, err := ioutil.ReadFile(config.EncryptionKeyFile)
+	if err != nil {
+		return utils.ErrorHandler(err)
+	}
+	public, err := parseX25519PublicKey(content)
+	if err != nil {
+		return utils.ErrorHandler(fmt.Errorf("%s: %v", config.EncryptionKeyFile, err))
+	}
+	id := config.EncryptionKeyID
+	if id == "" {
+		id = utils.KeyFingerprint(public.Bytes())
+	}
+	encryptionKey = &recipientKey{id: id, key: public}
+	return nil
+}
+
+// GenerateEncryptionKey func returns a new X25519 key pair in PEM, the public key goes to
+// --encryptionKeyFile and the private key stays with Secret Receiver
+func GenerateEncryptionKey() (*domain.KeyPair, error) {
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	return &domain.KeyPair{
+		ID:         utils.KeyFingerprint(private.PublicKey().Bytes()),
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})),
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+	}, nil
+}
+
+// encryptPayload func returns what is sent to Secret Receiver: secret itself without
+// encryption key, or a copy with Data and BinaryData encrypted. Checksum is kept, keyed with
+// the checksum key.
+func encryptPayload(secret *domain.Secret) (*domain.Secret, error) {
+	if encryptionKey == nil {
+		return secret, nil
+	}
+	encrypted, err := sealData(encryptionKey, secret.Data, additionalData(secret))
+	if err != nil {
+		return nil, err
+	}
+	payload := *secret
+	payload.Data = nil
+	payload.Encrypted = encrypted
+	if len(secret.BinaryData) != 0 {
+		payload.EncryptedBinary, err = sealData(encryptionKey, secret.BinaryData, binaryAdditionalData(secret))
+		if err != nil {
+			return nil, err
+		}
+		payload.BinaryData = nil
+	}
+	return &payload, nil
+}
+
+// sealData func encrypts data as JSON to recipient, bound to additional
+func sealData(recipient *recipientKey, data map[string]string, additional []byte) (*domain.EncryptedData, error) {
+	plaintext, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := ephemeral.ECDH(recipient.key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(shared, ephemeral.PublicKey().Bytes(), recipient.key.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	ciphertext := aead.Seal(nil, nonce, plaintext, additional)
+	return &domain.EncryptedData{
+		Algorithm:    encryptionAlgorithm,
+		KeyID:        recipient.id,
+		EphemeralKey: base64.StdEncoding.EncodeToString(ephemeral.PublicKey().Bytes()),
+		Nonce:        base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext:   base64.StdEncoding.EncodeToString(ciphertext),
+	}, nil
+}
+
+// ReadEncryptedSecret func reads one secret body in JSON or YAML from filename, - reads stdin
+func ReadEncryptedSecret(filename string) (*domain.Secret, error) {
+	content, err := readInput(filename)
+	if err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
+	secret := &domain.Secret{}
+	if err := yaml.Unmarshal(content, secret); err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
+	return secret, nil
+}
+
+// DecryptSecret func replaces secret.Encrypted and secret.EncryptedBinary with the plain Data and
+// BinaryData using a PEM X25519 private key. It does what Secret Receiver does and is meant for tests.
+func DecryptSecret(secret *domain.Secret, privatePEM []byte) error {
+	if secret.Encrypted == nil {
+		return utils.ErrorHandler(errors.New("secret is not encrypted"))
+	}
+	private, err := parseX25519PrivateKey(privatePEM)
+	if err != nil {
+		return utils.ErrorHandler(err)
+	}
+	data, err := openData(private, secret.Encrypted, additionalData(secret))
+	if err != nil {
+		return utils.ErrorHandler(fmt.Errorf("cannot decrypt secret %s: %w", secret.Name, err))
+	}
+	if secret.EncryptedBinary != nil {
+		binaryData, err := openData(private, secret.EncryptedBinary, binaryAdditionalData(secret))
+		if err != nil {
+			return utils.ErrorHandler(fmt.Errorf("cannot decrypt binary data of secret %s: %w", secret.Name, err))
+		}
+		secret.BinaryData = binaryData
+		secret.EncryptedBinary = nil
+	}
+	secret.Data = data
+	secret.Encrypted = nil
+	return nil
+}
+
+// openData func decrypts a map encrypted by sealData
+func openData(private *ecdh.PrivateKey, encrypted *domain.EncryptedData, additional []byte) (map[string]string, error) {
+	if encrypted.Algorithm != encryptionAlgorithm {
+		return nil, fmt.Errorf("unknown algorithm %q", encrypted.Algorithm)
+	}
+	ephemeralBytes, err := base64.StdEncoding.DecodeString(encrypted.EphemeralKey)
+	if err != nil {
+		return nil, err
+	}
+	ephemeral, err := ecdh.X25519().NewPublicKey(ephemeralBytes)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := base64.StdEncoding.DecodeString(encrypted.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(encrypted.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := private.ECDH(ephemeral)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(shared, ephemeralBytes, private.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce")
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additional)
+	if err != nil {
+		return nil, err
+	}
+	data := make(map[string]string)
+	if err := json.Unmarshal(plaintext, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// newAEAD func derives the AES-256-GCM key from the shared secret and both public keys
+func newAEAD(shared, ephemeral, recipient []byte) (cipher.AEAD, error) {
+	hash := sha256.New()
+	hash.Write([]byte(encryptionAlgorithm))
+	hash.Write(shared)
+	hash.Write(ephemeral)
+	hash.Write(recipient)
+	block, err := aes.NewCipher(hash.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// additionalData func binds the ciphertext to the destination, so it cannot be moved to another secret
+func additionalData(secret *domain.Secret) []byte {
+	return []byte(fmt.Sprintf("%s/%s", secret.Namespace, secret.Name))
+}
+
+// binaryAdditionalData func binds the BinaryData ciphertext to the destination too, and keeps it
+// from being used as Data
+func binaryAdditionalData(secret *domain.Secret) []byte {
+	return []byte(fmt.Sprintf("%s/%s/binaryData", secret.Namespace, secret.Name))
+}
+
+// parseX25519PublicKey func reads a PEM PKIX X25519 public key
+func parseX25519PublicKey(content []byte) (*ecdh.PublicKey, error) {
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("no PEM PUBLIC KEY")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	public, ok := parsed.(*ecdh.PublicKey)
+	if !ok || public.Curve() != ecdh.X25519() {
+		return nil, errors.New("not an X25519 public key")
+	}
+	return public, nil
+}
+
+// parseX25519PrivateKey func reads a PEM PKCS #8 X25519 private key
+func parseX25519PrivateKey(content []byte) (*ecdh.PrivateKey, error) {
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("no PEM PRIVATE KEY")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	private, ok := parsed.(*ecdh.PrivateKey)
+	if !ok || private.Curve() != ecdh.X25519() {
+		return nil, errors.New("not an X25519 private key")
+	}
+	return private, nil
+}
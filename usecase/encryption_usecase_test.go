@@ -0,0 +1,79 @@
+package usecase
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptPayload(t *testing.T) {
+	secret := &domain.Secret{Name: "foo", Namespace: "default", Data: map[string]string{"user": "admin"}}
+	payload, err := encryptPayload(secret)
+	assert.NoError(t, err)
+	assert.Equal(t, secret, payload)
+
+	pair, err := GenerateEncryptionKey()
+	assert.NoError(t, err)
+	file, err := ioutil.TempFile("", "receiver-*.pub")
+	assert.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(pair.PublicKey)
+	assert.NoError(t, err)
+	file.Close()
+	key, err := ioutil.TempFile("", "checksum-*.key")
+	assert.NoError(t, err)
+	defer os.Remove(key.Name())
+	_, err = key.WriteString("short\n")
+	assert.NoError(t, err)
+	key.Close()
+	config.EncryptionKeyFile = file.Name()
+	config.ChecksumKeyFile = key.Name()
+	defer func() {
+		config.EncryptionKeyFile, config.ChecksumKeyFile = "", ""
+		encryptionKey, checksumKey = nil, nil
+	}()
+	assert.Error(t, LoadEncryptionKey())
+	assert.NoError(t, ioutil.WriteFile(key.Name(), []byte("0123456789abcdef0123456789abcdef\n"), 0600))
+	assert.NoError(t, LoadEncryptionKey())
+
+	setChecksum(secret)
+	assert.Equal(t, createCheckSum("admin"), secret.Checksum)
+	// the plain sha512 of the data is not sent
+	checksumKey = nil
+	assert.NotEqual(t, createCheckSum("admin"), secret.Checksum)
+	checksumKey = []byte("0123456789abcdef0123456789abcdef")
+	payload, err = encryptPayload(secret)
+	assert.NoError(t, err)
+	assert.Nil(t, payload.Data)
+	assert.Equal(t, secret.Checksum, payload.Checksum)
+	assert.Equal(t, pair.ID, payload.Encrypted.KeyID)
+	assert.NotContains(t, payload.Encrypted.Ciphertext, "admin")
+	assert.Equal(t, "admin", secret.Data["user"])
+
+	moved := *payload
+	moved.Namespace = "other"
+	assert.Error(t, DecryptSecret(&moved, []byte(pair.PrivateKey)))
+	other, err := GenerateEncryptionKey()
+	assert.NoError(t, err)
+	assert.Error(t, DecryptSecret(payload, []byte(other.PrivateKey)))
+
+	assert.NoError(t, DecryptSecret(payload, []byte(pair.PrivateKey)))
+	assert.Equal(t, secret.Data, payload.Data)
+	assert.Nil(t, payload.Encrypted)
+
+	secret.BinaryData = map[string]string{"keystore": "/wD+"}
+	payload, err = encryptPayload(secret)
+	assert.NoError(t, err)
+	assert.Nil(t, payload.BinaryData)
+	assert.NotNil(t, payload.EncryptedBinary)
+	swapped := *payload
+	swapped.Encrypted, swapped.EncryptedBinary = payload.EncryptedBinary, payload.Encrypted
+	assert.Error(t, DecryptSecret(&swapped, []byte(pair.PrivateKey)))
+	assert.NoError(t, DecryptSecret(payload, []byte(pair.PrivateKey)))
+	assert.Equal(t, secret.BinaryData, payload.BinaryData)
+	assert.Nil(t, payload.EncryptedBinary)
+}
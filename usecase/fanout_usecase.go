@@ -0,0 +1,83 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/betorvs/secretpublisher/utils"
+)
+
+// manageTargets func runs manageSecret in every target at the same time and returns one result
+// with the result of each target in Targets. The output of each target is printed in order,
+// after every target finished. It fails when less than the quorum of targets succeed.
+func manageTargets(ctx context.Context, out io.Writer, fanout domain.Fanout, secretName string, secret *domain.Secret) (*domain.Result, error) {
+	start := time.Now()
+	targets := fanout.Targets()
+	results := make([]*domain.Result, len(targets))
+	errs := make([]error, len(targets))
+	runTargets(out, targets, func(i int, target *domain.Target, out io.Writer) {
+		copied, err := target.Secret(secret)
+		if err != nil {
+			results[i], errs[i] = NewResult(secretName, secret.Namespace, domain.ActionFailed, time.Now(), err), err
+		} else {
+			results[i], errs[i] = manageSecretIn(ctx, out, target.Repository, secretName, copied)
+		}
+		results[i].Target = target.Name
+		if errs[i] != nil {
+			errs[i] = fmt.Errorf("%s: %w", target.Name, errs[i])
+		}
+	})
+	err := domain.QuorumError(fanout.Quorum(), errs)
+	if err != nil {
+		err = utils.ErrorHandler(err)
+	}
+	result := NewResult(secretName, secret.Namespace, targetsAction(results), start, err)
+	result.Targets = results
+	if err == nil {
+		result.ChecksumAfter = secret.Checksum
+	}
+	return result, err
+}
+
+// runTargets func calls work for every target at the same time, each one with its own output,
+// and prints the output of each target in order with the target name after every target finished
+func runTargets(out io.Writer, targets []*domain.Target, work func(i int, target *domain.Target, out io.Writer)) {
+	outputs := make([]bytes.Buffer, len(targets))
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target *domain.Target) {
+			defer wg.Done()
+			work(i, target, &outputs[i])
+		}(i, target)
+	}
+	wg.Wait()
+	for i, target := range targets {
+		printTarget(out, target.Name, outputs[i].String())
+	}
+}
+
+// targetsAction func returns the first created or updated action in results, or unchanged
+func targetsAction(results []*domain.Result) string {
+	for _, result := range results {
+		if result.Action == domain.ActionCreated || result.Action == domain.ActionUpdated {
+			return result.Action
+		}
+	}
+	return domain.ActionUnchanged
+}
+
+// printTarget func prints each line of output with the target name
+func printTarget(out io.Writer, name, output string) {
+	for _, line := range strings.Split(strings.TrimRight(output, "\n"), "\n") {
+		if line != "" {
+			fmt.Fprintf(out, "[%s] %s\n", name, line)
+		}
+	}
+}
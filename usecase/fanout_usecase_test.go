@@ -0,0 +1,97 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/betorvs/secretpublisher/appcontext"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/betorvs/secretpublisher/gateway/fanout"
+	"github.com/stretchr/testify/assert"
+)
+
+// targetMock is one receiver, with the namespace of the last secret sent to it
+type targetMock struct {
+	RepositoryMock
+	checksum  string
+	err       error
+	namespace *string
+}
+
+func (repo targetMock) GetSecret(ctx context.Context, name string, namespace string) (*domain.SecretStatus, error) {
+	if repo.err != nil {
+		return nil, repo.err
+	}
+	return &domain.SecretStatus{Found: repo.checksum != "", Checksum: repo.checksum}, nil
+}
+
+func (repo targetMock) CreateSecret(ctx context.Context, secret *domain.Secret) error {
+	*repo.namespace = secret.Namespace
+	return repo.err
+}
+
+func (repo targetMock) UpdateSecret(ctx context.Context, secret *domain.Secret) error {
+	*repo.namespace = secret.Namespace
+	return repo.err
+}
+
+// fanoutMock publishes to targets
+type fanoutMock struct {
+	RepositoryMock
+	targets []*domain.Target
+	quorum  int
+}
+
+func (repo fanoutMock) Targets() []*domain.Target {
+	return repo.targets
+}
+
+func (repo fanoutMock) Quorum() int {
+	return repo.quorum
+}
+
+func TestManageTargets(t *testing.T) {
+	var a, b, c string
+	secret := GenerateSecret("foo")
+	secret.Namespace = "default"
+	repo := fanoutMock{
+		targets: []*domain.Target{
+			{Name: "a", Repository: targetMock{checksum: secret.Checksum, namespace: &a}},
+			{Name: "b", Repository: targetMock{namespace: &b}, Namespaces: map[string]string{"default": "prod"}},
+			{Name: "c", Repository: targetMock{err: domain.ErrServer, namespace: &c}},
+		},
+		quorum: 2,
+	}
+	appcontext.Current.Add(appcontext.Repository, repo)
+	out := &bytes.Buffer{}
+	result, err := manageSecret(context.Background(), out, "foo", secret)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.ActionCreated, result.Action)
+	assert.Len(t, result.Targets, 3)
+	assert.Equal(t, domain.ActionUnchanged, result.Targets[0].Action)
+	assert.Equal(t, domain.ActionCreated, result.Targets[1].Action)
+	assert.Equal(t, "prod", result.Targets[1].Namespace)
+	assert.Equal(t, domain.ActionFailed, result.Targets[2].Action)
+	assert.Equal(t, "c", result.Targets[2].Target)
+	assert.Equal(t, "prod", b)
+	assert.Contains(t, out.String(), "[a] [OK] Secret foo already exist\n[b] [OK] Created\n")
+
+	repo.quorum = 3
+	appcontext.Current.Add(appcontext.Repository, repo)
+	result, err = manageSecret(context.Background(), out, "foo", secret)
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, domain.ErrServer))
+	assert.Equal(t, domain.ActionFailed, result.Action)
+
+	// create and update use the fanout repository
+	gatewayRepo, err := fanout.NewRepository(repo.targets, 3)
+	assert.NoError(t, err)
+	appcontext.Current.Add(appcontext.Repository, gatewayRepo)
+	err = UpdateSecret(context.Background(), "foo", secret)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "2 of 3 receivers succeeded")
+	assert.Equal(t, "default", a)
+	assert.Equal(t, "default", secret.Namespace)
+}
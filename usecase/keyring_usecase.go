@@ -0,0 +1,264 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/betorvs/secretpublisher/gateway/kubeclient"
+	"github.com/betorvs/secretpublisher/utils"
+	"gopkg.in/yaml.v2"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// keyringSecretKey is the key with the keyring in the kubernetes secret set by --keyringSecret
+	keyringSecretKey = "keyring.yaml"
+	// keyringReloadPeriod is how often watch mode reads the keyrings again
+	keyringReloadPeriod = time.Minute
+)
+
+// loadedKeyring is a keyring returned by LoadKeyring or LoadReceivers, with the func that reads it again
+type loadedKeyring struct {
+	keyring *domain.Keyring
+	read    func() (*domain.Keyring, error)
+}
+
+// loadedKeyrings has the keyrings read again by reloadKeyrings, by name
+var loadedKeyrings = map[string]loadedKeyring{}
+
+// LoadKeyring func reads the keyring from config.KeyringFile or config.KeyringSecret.
+// It returns nil when none is set, then config.EncodingRequest is the signing key.
+func LoadKeyring() (*domain.Keyring, error) {
+	delete(loadedKeyrings, "keyring")
+	keyring, err := readSigningKeyring()
+	if err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
+	if keyring != nil {
+		loadedKeyrings["keyring"] = loadedKeyring{keyring: keyring, read: readSigningKeyring}
+	}
+	return keyring, nil
+}
+
+// readSigningKeyring func reads the keyring of LoadKeyring, failing when its source is empty
+func readSigningKeyring() (*domain.Keyring, error) {
+	keyring, source, err := readKeyring()
+	if err != nil {
+		return nil, err
+	}
+	if source != nil && keyring == nil {
+		return nil, fmt.Errorf("keyring not found, create it with rotate-key")
+	}
+	return keyring, nil
+}
+
+// watchKeyrings func calls reloadKeyrings every keyringReloadPeriod until ctx is done,
+// so keys rotated while watching are used without a restart
+func watchKeyrings(ctx context.Context) {
+	if len(loadedKeyrings) == 0 {
+		return
+	}
+	ticker := time.NewTicker(keyringReloadPeriod)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloadKeyrings(utils.Out())
+		}
+	}
+}
+
+// reloadKeyrings func reads every loaded keyring again and replaces its keys.
+// A keyring that cannot be read keeps the previous keys.
+func reloadKeyrings(out io.Writer) {
+	names := make([]string, 0, len(loadedKeyrings))
+	for name := range loadedKeyrings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		loaded := loadedKeyrings[name]
+		keyring, err := loaded.read()
+		if err != nil {
+			fmt.Fprintf(out, "[ERROR] Cannot reload %s, keeping the previous keys: %v\n", name, err)
+			continue
+		}
+		loaded.keyring.Replace(keyring.Keys)
+	}
+}
+
+// RotateKey func adds a new signing key to the keyring and saves it. The new key is used
+// after config.KeyActivateIn, and the other keys stay valid for config.KeyGracePeriod more.
+// Keys already expired are removed. An empty keyID becomes key-YYYYMMDDHHMMSS.
+func RotateKey(keyID string) (*domain.Keyring, error) {
+	keyring, source, err := readKeyring()
+	if err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
+	if source == nil {
+		return nil, utils.ErrorHandler(fmt.Errorf("rotate-key needs --keyringFile or --keyringSecret"))
+	}
+	if keyring == nil {
+		keyring = &domain.Keyring{}
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	if keyID == "" {
+		keyID = fmt.Sprintf("key-%s", now.Format("20060102150405"))
+	}
+	secret, err := newKeySecret()
+	if err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
+	if err := rotateKeyring(keyring, keyID, secret, now, config.KeyActivateIn, config.KeyGracePeriod); err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
+	if config.DryRun {
+		return keyring, nil
+	}
+	if err := source.save(keyring); err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
+	return keyring, nil
+}
+
+// RedactKeyring func returns a copy of keyring without key secrets, to be printed
+func RedactKeyring(keyring *domain.Keyring) *domain.Keyring {
+	redacted := &domain.Keyring{Keys: make([]*domain.SigningKey, 0, len(keyring.Keys))}
+	for _, key := range keyring.Keys {
+		redacted.Keys = append(redacted.Keys, &domain.SigningKey{ID: key.ID, NotBefore: key.NotBefore, NotAfter: key.NotAfter})
+	}
+	return redacted
+}
+
+// KeyValidity func describes when key can be used, like "from 2022-01-02T15:04:05Z until 2022-01-03T15:04:05Z"
+func KeyValidity(key *domain.SigningKey) string {
+	validity := "always"
+	if key.NotBefore != nil {
+		validity = fmt.Sprintf("from %s", key.NotBefore.Format(time.RFC3339))
+	}
+	if key.NotAfter != nil {
+		if key.NotBefore == nil {
+			return fmt.Sprintf("until %s", key.NotAfter.Format(time.RFC3339))
+		}
+		validity = fmt.Sprintf("%s until %s", validity, key.NotAfter.Format(time.RFC3339))
+	}
+	return validity
+}
+
+// rotateKeyring func adds the key id starting at now+activateIn, limits the other keys to
+// activateIn+grace from now and removes the keys expired at now
+func rotateKeyring(keyring *domain.Keyring, id, secret string, now time.Time, activateIn, grace time.Duration) error {
+	for _, key := range keyring.Keys {
+		if key.ID == id {
+			return fmt.Errorf("key %s already exists", id)
+		}
+	}
+	start := now.Add(activateIn)
+	end := start.Add(grace)
+	keys := make([]*domain.SigningKey, 0, len(keyring.Keys)+1)
+	for _, key := range keyring.Keys {
+		if key.NotAfter != nil && !now.Before(*key.NotAfter) {
+			continue
+		}
+		if key.NotAfter == nil || key.NotAfter.After(end) {
+			key.NotAfter = &end
+		}
+		keys = append(keys, key)
+	}
+	keyring.Keys = append(keys, &domain.SigningKey{ID: id, Secret: secret, NotBefore: &start})
+	return nil
+}
+
+// newKeySecret func returns 32 random bytes in hex
+func newKeySecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// keyringSource is where the keyring was read from, a file or a kubernetes secret
+type keyringSource struct {
+	file   string
+	secret *v1.Secret
+}
+
+// readKeyring func reads the keyring and returns where it came from, both nil without keyring.
+// A missing file or kubernetes secret returns a nil keyring with its source, to be created by RotateKey.
+func readKeyring() (*domain.Keyring, *keyringSource, error) {
+	switch {
+	case config.KeyringFile != "":
+		source := &keyringSource{file: config.KeyringFile}
+		content, err := ioutil.ReadFile(config.KeyringFile)
+		if os.IsNotExist(err) {
+			return nil, source, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		keyring, err := parseKeyring(content)
+		return keyring, source, err
+	case config.KeyringSecret != "":
+		parts := strings.SplitN(config.KeyringSecret, "/", 2)
+		secret, err := kubeclient.GetSecret(parts[0], parts[1])
+		if err != nil {
+			return nil, nil, err
+		}
+		if secret == nil {
+			secret = &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: parts[1], Namespace: parts[0]}}
+			return nil, &keyringSource{secret: secret}, nil
+		}
+		keyring, err := parseKeyring(secret.Data[keyringSecretKey])
+		return keyring, &keyringSource{secret: secret}, err
+	}
+	return nil, nil, nil
+}
+
+// save func writes the keyring back where it was read from
+func (source *keyringSource) save(keyring *domain.Keyring) error {
+	content, err := yaml.Marshal(keyring)
+	if err != nil {
+		return err
+	}
+	if source.secret == nil {
+		return ioutil.WriteFile(source.file, content, 0600)
+	}
+	if source.secret.Data == nil {
+		source.secret.Data = make(map[string][]byte)
+	}
+	source.secret.Data[keyringSecretKey] = content
+	return kubeclient.SaveSecret(source.secret)
+}
+
+// parseKeyring func reads a keyring in YAML or JSON, every key needs id and secret
+func parseKeyring(content []byte) (*domain.Keyring, error) {
+	keyring := &domain.Keyring{}
+	if err := yaml.Unmarshal(content, keyring); err != nil {
+		return nil, fmt.Errorf("cannot parse keyring: %v", err)
+	}
+	seen := make(map[string]bool)
+	for i, key := range keyring.Keys {
+		if key == nil || key.ID == "" || key.Secret == "" {
+			return nil, fmt.Errorf("key %d in keyring needs id and secret", i+1)
+		}
+		if seen[key.ID] {
+			return nil, fmt.Errorf("key %s is duplicated in keyring", key.ID)
+		}
+		seen[key.ID] = true
+	}
+	return keyring, nil
+}
@@ -0,0 +1,94 @@
+package usecase
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKeyring(t *testing.T) {
+	keyring, err := parseKeyring([]byte("keys:\n- id: old\n  secret: a\n  notAfter: 2022-01-02T00:00:00Z\n- id: new\n  secret: b\n  notBefore: 2022-01-01T00:00:00Z\n"))
+	assert.NoError(t, err)
+	assert.Len(t, keyring.Keys, 2)
+	assert.Equal(t, time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC), keyring.Keys[0].NotAfter.UTC())
+	assert.Equal(t, "old", keyring.Active(time.Date(2021, 12, 31, 0, 0, 0, 0, time.UTC)).ID)
+	assert.Equal(t, "new", keyring.Active(time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)).ID)
+
+	_, err = parseKeyring([]byte("keys:\n- id: old\n"))
+	assert.Error(t, err)
+	_, err = parseKeyring([]byte("keys:\n- id: old\n  secret: a\n- id: old\n  secret: b\n"))
+	assert.Error(t, err)
+}
+
+func TestRotateKeyring(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	expired := now.Add(-time.Minute)
+	keyring := &domain.Keyring{Keys: []*domain.SigningKey{
+		{ID: "expired", Secret: "a", NotAfter: &expired},
+		{ID: "current", Secret: "b"},
+	}}
+	assert.NoError(t, rotateKeyring(keyring, "next", "c", now, time.Hour, 24*time.Hour))
+	assert.Error(t, rotateKeyring(keyring, "next", "d", now, 0, 0))
+	assert.Len(t, keyring.Keys, 2)
+	assert.Equal(t, now.Add(25*time.Hour), *keyring.Keys[0].NotAfter)
+	assert.Equal(t, now.Add(time.Hour), *keyring.Keys[1].NotBefore)
+	// the current key signs until the new key is active, and both are valid in the grace period
+	assert.Equal(t, "current", keyring.Active(now.Add(30*time.Minute)).ID)
+	assert.Equal(t, "next", keyring.Active(now.Add(2*time.Hour)).ID)
+	assert.True(t, keyring.Keys[0].Valid(now.Add(2*time.Hour)))
+	assert.False(t, keyring.Keys[0].Valid(now.Add(26*time.Hour)))
+}
+
+func TestRotateKeyFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyring")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	config.KeyringFile = filepath.Join(dir, "keyring.yaml")
+	defer func() { config.KeyringFile = "" }()
+
+	_, err = LoadKeyring()
+	assert.Error(t, err)
+	_, err = RotateKey("first")
+	assert.NoError(t, err)
+	_, err = RotateKey("")
+	assert.NoError(t, err)
+	keyring, err := LoadKeyring()
+	assert.NoError(t, err)
+	assert.Len(t, keyring.Keys, 2)
+	assert.Equal(t, "first", keyring.Keys[0].ID)
+	assert.NotNil(t, keyring.Keys[0].NotAfter)
+	assert.Len(t, keyring.Keys[1].Secret, 64)
+	assert.Empty(t, RedactKeyring(keyring).Keys[1].Secret)
+}
+
+func TestReloadKeyrings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keyring")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	config.KeyringFile = filepath.Join(dir, "keyring.yaml")
+	defer func() { config.KeyringFile = "" }()
+	assert.NoError(t, ioutil.WriteFile(config.KeyringFile, []byte("keys:\n- id: old\n  secret: a\n"), 0600))
+	keyring, err := LoadKeyring()
+	assert.NoError(t, err)
+	defer delete(loadedKeyrings, "keyring")
+	assert.Equal(t, "old", keyring.Active(time.Now()).ID)
+
+	// rotated by another process
+	expired := time.Now().Add(-time.Minute)
+	assert.NoError(t, ioutil.WriteFile(config.KeyringFile, []byte("keys:\n- id: old\n  secret: a\n  notAfter: "+expired.Format(time.RFC3339)+"\n- id: new\n  secret: b\n"), 0600))
+	reloadKeyrings(ioutil.Discard)
+	assert.Equal(t, "new", keyring.Active(time.Now()).ID)
+
+	assert.NoError(t, ioutil.WriteFile(config.KeyringFile, []byte("keys:\n- id: broken\n"), 0600))
+	var out strings.Builder
+	reloadKeyrings(&out)
+	assert.Contains(t, out.String(), "Cannot reload keyring")
+	assert.Equal(t, "new", keyring.Active(time.Now()).ID)
+}
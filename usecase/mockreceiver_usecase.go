@@ -0,0 +1,107 @@
+package usecase
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/mockreceiver"
+	"github.com/betorvs/secretpublisher/utils"
+)
+
+// defaultMockListen is the address of the mock receiver without --listen
+const defaultMockListen = ":8080"
+
+// validateMockReceiver func checks the mock-receiver flags and fills config.MockListen
+func validateMockReceiver() error {
+	if config.MockFailureRate < 0 || config.MockFailureRate > 1 {
+		return fmt.Errorf("--failureRate must be between 0 and 1, got %v", config.MockFailureRate)
+	}
+	if config.MockListen == "" {
+		config.MockListen = defaultMockListen
+	}
+	return nil
+}
+
+// RunMockReceiver func serves the Secret Receiver API in memory on config.MockListen until
+// SIGTERM or SIGINT. It verifies signatures with config.EncodingRequest, the keyring and
+// config.PublicKeyFiles, and injects the latency and failures from flags.
+func RunMockReceiver() error {
+	if err := validateMockReceiver(); err != nil {
+		return utils.ErrorHandler(err)
+	}
+	keyring, err := LoadKeyring()
+	if err != nil {
+		return err
+	}
+	options := mockreceiver.Options{
+		EncodingRequest: config.EncodingRequest,
+		Keyring:         keyring,
+		Latency:         config.MockLatency,
+		FailFirst:       config.MockFailFirst,
+		FailureRate:     config.MockFailureRate,
+		FailureStatus:   config.MockFailureStatus,
+		Log:             utils.Out(),
+	}
+	for _, file := range config.PublicKeyFiles {
+		id, key, err := readEd25519PublicKey(file)
+		if err != nil {
+			return utils.ErrorHandler(err)
+		}
+		if options.PublicKeys == nil {
+			options.PublicKeys = make(map[string]ed25519.PublicKey)
+		}
+		options.PublicKeys[id] = key
+	}
+	server := &http.Server{Addr: config.MockListen, Handler: mockreceiver.New(options)}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+	fmt.Fprintf(utils.Out(), "[INFO] Mock Secret Receiver listening on %s\n", config.MockListen)
+	select {
+	case err := <-errs:
+		return utils.ErrorHandler(err)
+	case <-ctx.Done():
+	}
+	fmt.Fprintln(utils.Out(), "[INFO] Shutting down")
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdown); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return utils.ErrorHandler(err)
+	}
+	return nil
+}
+
+// readEd25519PublicKey func reads a PEM PKIX Ed25519 public key, its key id is the utils.KeyFingerprint
+func readEd25519PublicKey(file string) (string, ed25519.PublicKey, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return "", nil, fmt.Errorf("%s has no PEM PUBLIC KEY", file)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot parse %s: %v", file, err)
+	}
+	key, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return "", nil, fmt.Errorf("%s is not an Ed25519 key", file)
+	}
+	return utils.KeyFingerprint(key), key, nil
+}
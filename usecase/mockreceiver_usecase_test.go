@@ -0,0 +1,45 @@
+package usecase
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadEd25519PublicKey(t *testing.T) {
+	public, _, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(public)
+	assert.NoError(t, err)
+	file := filepath.Join(t.TempDir(), "publisher.pub")
+	assert.NoError(t, ioutil.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600))
+	id, key, err := readEd25519PublicKey(file)
+	assert.NoError(t, err)
+	assert.Equal(t, utils.KeyFingerprint(public), id)
+	assert.Equal(t, public, key)
+
+	assert.NoError(t, ioutil.WriteFile(file, []byte("not a key"), 0600))
+	_, _, err = readEd25519PublicKey(file)
+	assert.Error(t, err)
+}
+
+func TestValidateMockReceiver(t *testing.T) {
+	defer func() { config.MockListen, config.MockFailureRate = "", 0 }()
+	config.MockListen, config.MockFailureRate = "", 1.5
+	assert.EqualError(t, validateMockReceiver(), "--failureRate must be between 0 and 1, got 1.5")
+	config.MockFailureRate = -0.1
+	assert.Error(t, validateMockReceiver())
+	config.MockFailureRate = 0.5
+	assert.NoError(t, validateMockReceiver())
+	assert.Equal(t, ":8080", config.MockListen)
+	config.MockListen = "127.0.0.1:9090"
+	assert.NoError(t, validateMockReceiver())
+	assert.Equal(t, "127.0.0.1:9090", config.MockListen)
+}
@@ -0,0 +1,90 @@
+package usecase
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/betorvs/secretpublisher/domain"
+)
+
+// planVerbs translates an action into the verb printed in a plan
+var planVerbs = map[string]string{
+	domain.ActionCreated:   "create",
+	domain.ActionUpdated:   "update",
+	domain.ActionUnchanged: "unchanged",
+	domain.ActionDeleted:   "delete",
+}
+
+// printPlan func prints what would happen with a secret in dry run mode.
+// When remote has data, a key level diff is printed with values redacted.
+func printPlan(out io.Writer, action string, secret *domain.Secret, remote *domain.Secret) {
+	fmt.Fprintf(out, "[PLAN] %s secret %s in namespace %s\n", planVerbs[action], secret.Name, secret.Namespace)
+	var current *domain.Secret
+	switch action {
+	case domain.ActionCreated:
+		current = &domain.Secret{Data: map[string]string{}}
+	case domain.ActionUpdated:
+		if remote == nil || remote.Data == nil {
+			return
+		}
+		current = remote
+	default:
+		return
+	}
+	for _, line := range diffSecret(current, secret) {
+		fmt.Fprintf(out, "  %s\n", line)
+	}
+}
+
+// diffSecret func compares data and binary data of two secrets with diffSecretData, and
+// their type and immutable when current has them
+func diffSecret(current, desired *domain.Secret) []string {
+	lines := diffSecretData(plainData(current), plainData(desired))
+	if current.Type != "" && current.Type != secretTypeName(desired.Type) {
+		lines = append(lines, fmt.Sprintf("~ type: %s -> %s", current.Type, secretTypeName(desired.Type)))
+	}
+	if current.Immutable != desired.Immutable && (current.Type != "" || current.Immutable) {
+		lines = append(lines, fmt.Sprintf("~ immutable: %t -> %t", current.Immutable, desired.Immutable))
+	}
+	return lines
+}
+
+// secretTypeName func returns the secret type, Opaque when it is empty
+func secretTypeName(secretType string) string {
+	if secretType == "" {
+		return secretTypeOpaque
+	}
+	return secretType
+}
+
+// diffSecretData func compares two data maps by key and returns one line per
+// added (+), removed (-) or changed (~) key. Values are never printed.
+func diffSecretData(current, desired map[string]string) []string {
+	keys := make(map[string]bool)
+	for k := range current {
+		keys[k] = true
+	}
+	for k := range desired {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	var lines []string
+	for _, k := range sorted {
+		oldValue, inCurrent := current[k]
+		newValue, inDesired := desired[k]
+		switch {
+		case !inCurrent:
+			lines = append(lines, fmt.Sprintf("+ %s: (redacted)", k))
+		case !inDesired:
+			lines = append(lines, fmt.Sprintf("- %s: (redacted)", k))
+		case oldValue != newValue:
+			lines = append(lines, fmt.Sprintf("~ %s: (redacted)", k))
+		}
+	}
+	return lines
+}
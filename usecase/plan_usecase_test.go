@@ -0,0 +1,30 @@
+package usecase
+
+import (
+	"testing"
+
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffSecretData(t *testing.T) {
+	current := map[string]string{"user": "admin", "password": "old", "host": "localhost"}
+	desired := map[string]string{"user": "admin", "password": "new", "port": "5432"}
+	test := diffSecretData(current, desired)
+	expected := []string{"- host: (redacted)", "~ password: (redacted)", "+ port: (redacted)"}
+	assert.Equal(t, expected, test)
+	for _, line := range test {
+		assert.NotContains(t, line, "new")
+		assert.NotContains(t, line, "old")
+	}
+}
+
+func TestDiffSecret(t *testing.T) {
+	current := &domain.Secret{Type: "Opaque", Data: map[string]string{"tls.crt": "old"}}
+	desired := &domain.Secret{Type: "kubernetes.io/tls", Immutable: true, Data: map[string]string{"tls.crt": "old"}, BinaryData: map[string]string{"keystore": "/wD+"}}
+	expected := []string{"+ keystore: (redacted)", "~ type: Opaque -> kubernetes.io/tls", "~ immutable: false -> true"}
+	assert.Equal(t, expected, diffSecret(current, desired))
+	// backends that do not keep the type
+	assert.Equal(t, []string{"+ keystore: (redacted)"}, diffSecret(&domain.Secret{Data: current.Data}, desired))
+	assert.Empty(t, diffSecret(&domain.Secret{Type: "Opaque", Data: current.Data}, &domain.Secret{Data: current.Data}))
+}
@@ -0,0 +1,81 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/betorvs/secretpublisher/utils"
+)
+
+// concurrency func returns config.Concurrency, at least 1: 0 means one secret at a time
+func concurrency() int {
+	if config.Concurrency < 1 {
+		return 1
+	}
+	return config.Concurrency
+}
+
+// manageSecrets func runs manageSecret for every secret with concurrency() workers.
+// The output of each secret is printed in the same order as secrets, and
+// results and errors are returned by index.
+func manageSecrets(ctx context.Context, secrets []*domain.Secret) ([]*domain.Result, []error) {
+	results := make([]*domain.Result, len(secrets))
+	errs := runPool(concurrency(), len(secrets), utils.Out(), func(i int, out io.Writer) error {
+		secret := secrets[i]
+		result, err := manageSecret(ctx, out, secret.Name, secret)
+		if err != nil {
+			fmt.Fprintf(out, "[ERROR] Secret %s in namespace %s: %v\n", secret.Name, secret.Namespace, err)
+		}
+		results[i] = result
+		return err
+	})
+	return results, errs
+}
+
+// runPool func calls work for each index from 0 to count-1 with size workers.
+// Each call writes to its own buffer, copied to out in index order as soon as
+// all previous calls finished, so the output does not depend on scheduling.
+func runPool(size, count int, out io.Writer, work func(i int, out io.Writer) error) []error {
+	errs := make([]error, count)
+	buffers := make([]bytes.Buffer, count)
+	done := make([]chan struct{}, count)
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	jobs := make(chan int)
+	var workers sync.WaitGroup
+	if size > count {
+		size = count
+	}
+	for w := 0; w < size; w++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for i := range jobs {
+				errs[i] = work(i, &buffers[i])
+				close(done[i])
+			}
+		}()
+	}
+	go func() {
+		for i := 0; i < count; i++ {
+			jobs <- i
+		}
+		close(jobs)
+	}()
+	for i := 0; i < count; i++ {
+		<-done[i]
+		if _, err := out.Write(buffers[i].Bytes()); err != nil {
+			fmt.Fprintf(os.Stderr, "[ERROR] %v\n", err)
+		}
+		buffers[i].Reset()
+	}
+	workers.Wait()
+	return errs
+}
@@ -0,0 +1,46 @@
+package usecase
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunPool(t *testing.T) {
+	var out bytes.Buffer
+	var running, maxRunning int32
+	errs := runPool(4, 20, &out, func(i int, w io.Writer) error {
+		now := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&maxRunning)
+			if now <= old || atomic.CompareAndSwapInt32(&maxRunning, old, now) {
+				break
+			}
+		}
+		// later items finish first
+		time.Sleep(time.Duration(20-i) * time.Millisecond)
+		fmt.Fprintf(w, "%d\n", i)
+		atomic.AddInt32(&running, -1)
+		if i%5 == 0 {
+			return errors.New("fail")
+		}
+		return nil
+	})
+	var expected bytes.Buffer
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&expected, "%d\n", i)
+	}
+	assert.Equal(t, expected.String(), out.String())
+	assert.LessOrEqual(t, maxRunning, int32(4))
+	assert.Greater(t, maxRunning, int32(1))
+	for i, err := range errs {
+		assert.Equal(t, i%5 == 0, err != nil)
+	}
+	assert.Empty(t, runPool(4, 0, &out, nil))
+}
@@ -0,0 +1,222 @@
+package usecase
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/betorvs/secretpublisher/gateway/kubeclient"
+	"github.com/betorvs/secretpublisher/utils"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ownerLabel is added to every secret sent to Secret Receiver when config.PublisherID is set
+const ownerLabel = "secretpublisher.betorvs.github.com/owner"
+
+// inventory keeps which secrets one scan sent to Secret Receiver, so the ones
+// whose source was removed can be deleted. It is saved in a config map in
+// config.SecretNamespace, with one key per kind and label selector.
+type inventory struct {
+	mu      sync.Mutex
+	key     string
+	entries map[string]bool
+	cm      *v1.ConfigMap
+}
+
+// validatePrune func checks the configuration needed by --prune
+func validatePrune() error {
+	if !config.Prune {
+		return nil
+	}
+	if config.PublisherID == "" {
+		return errors.New("--prune needs --publisherID")
+	}
+	if config.SecretNamespace == "" {
+		return errors.New("--prune needs --secretNamespace to keep the inventory")
+	}
+	return nil
+}
+
+// pruneScan func deletes secrets sent by a previous scan whose source is not in current anymore.
+// current has every source found by the scan, true when it was sent to Secret Receiver.
+func pruneScan(ctx context.Context, kind, labels string, current map[string]bool) ([]*domain.Result, error) {
+	if !config.Prune {
+		return nil, nil
+	}
+	inv, err := loadInventory(kind, labels)
+	if err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
+	return inv.prune(ctx, current)
+}
+
+// inventoryKey func returns the config map key for a kind and label selector
+func inventoryKey(kind, labels string) string {
+	sum := sha256.Sum256([]byte(labels))
+	return fmt.Sprintf("%s-%x", kind, sum[:5])
+}
+
+// secretKey func returns namespace/name used in the inventory
+func secretKey(secret *domain.Secret) string {
+	return fmt.Sprintf("%s/%s", secret.Namespace, secret.Name)
+}
+
+// loadInventory func reads the inventory for a kind and label selector
+func loadInventory(kind, labels string) (*inventory, error) {
+	inv := &inventory{
+		key:     inventoryKey(kind, labels),
+		entries: make(map[string]bool),
+	}
+	cm, err := kubeclient.GetConfigMap(config.SecretNamespace, inventoryName())
+	if err != nil {
+		return nil, err
+	}
+	if cm == nil {
+		cm = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      inventoryName(),
+				Namespace: config.SecretNamespace,
+				Labels:    map[string]string{ownerLabel: config.PublisherID},
+			},
+		}
+	}
+	inv.cm = cm
+	inv.entries = decodeInventory(cm.Data[inv.key])
+	return inv, nil
+}
+
+// inventoryName func returns config.InventoryName or a name based on config.PublisherID
+func inventoryName() string {
+	if config.InventoryName != "" {
+		return config.InventoryName
+	}
+	return fmt.Sprintf("secretpublisher-%s", config.PublisherID)
+}
+
+// save func writes the inventory back, it does nothing in dry run mode
+func (inv *inventory) save() error {
+	if config.DryRun {
+		return nil
+	}
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if inv.cm.Data == nil {
+		inv.cm.Data = make(map[string]string)
+	}
+	inv.cm.Data[inv.key] = encodeInventory(inv.entries)
+	saved, err := kubeclient.SaveConfigMap(inv.cm)
+	if err != nil {
+		return err
+	}
+	inv.cm = saved
+	return nil
+}
+
+// set func adds or removes one secret from the inventory and returns true when it changed
+func (inv *inventory) set(key string, present bool) bool {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	if inv.entries[key] == present {
+		return false
+	}
+	if present {
+		inv.entries[key] = true
+		return true
+	}
+	delete(inv.entries, key)
+	return true
+}
+
+// prune func deletes from Secret Receiver every inventory entry not in current, then keeps in
+// the inventory the entries still in current or that failed to be deleted, and adds the keys
+// sent in this run, true in current. A secret that never reached Secret Receiver is not owned.
+func (inv *inventory) prune(ctx context.Context, current map[string]bool) ([]*domain.Result, error) {
+	var failed []string
+	var results []*domain.Result
+	for _, key := range pruneCandidates(inv.entries, current) {
+		parts := strings.SplitN(key, "/", 2)
+		start := time.Now()
+		err := deleteSecret(ctx, utils.Out(), parts[1], parts[0])
+		if errors.Is(err, domain.ErrNotFound) {
+			// deleted already, by hand or by an earlier prune that could not save the inventory
+			err = nil
+		}
+		results = append(results, NewResult(parts[1], parts[0], domain.ActionDeleted, start, err))
+		if err != nil {
+			fmt.Fprintf(utils.Out(), "[ERROR] Cannot prune secret %s: %v\n", key, err)
+			failed = append(failed, key)
+			continue
+		}
+		if !config.DryRun {
+			fmt.Fprintf(utils.Out(), "[OK] Pruned %s\n", key)
+		}
+		inv.set(key, false)
+	}
+	for key, sent := range current {
+		if sent {
+			inv.set(key, true)
+		}
+	}
+	if errSave := inv.save(); errSave != nil {
+		return results, errSave
+	}
+	if len(failed) != 0 {
+		return results, fmt.Errorf("Cannot prune these secrets: %v", failed)
+	}
+	return results, nil
+}
+
+// pruneCandidates func returns the sorted keys in previous that are not in current
+func pruneCandidates(previous, current map[string]bool) []string {
+	var stale []string
+	for key := range previous {
+		if _, ok := current[key]; !ok {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+// encodeInventory func writes one namespace/name per line in order
+func encodeInventory(entries map[string]bool) string {
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "\n")
+}
+
+// decodeInventory func reads the lines written by encodeInventory
+func decodeInventory(value string) map[string]bool {
+	entries := make(map[string]bool)
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.Contains(line, "/") {
+			entries[line] = true
+		}
+	}
+	return entries
+}
+
+// withOwner func returns labels with ownerLabel when config.PublisherID is set
+func withOwner(labels map[string]string) map[string]string {
+	if config.PublisherID == "" {
+		return labels
+	}
+	owned := make(map[string]string, len(labels)+1)
+	for k, v := range labels {
+		owned[k] = v
+	}
+	owned[ownerLabel] = config.PublisherID
+	return owned
+}
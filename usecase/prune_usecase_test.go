@@ -0,0 +1,79 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+
+	"github.com/betorvs/secretpublisher/appcontext"
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPruneCandidates(t *testing.T) {
+	previous := map[string]bool{"ns/b": true, "ns/a": true, "ns/c": true}
+	current := map[string]bool{"ns/c": true, "ns/d": true}
+	assert.Equal(t, []string{"ns/a", "ns/b"}, pruneCandidates(previous, current))
+	assert.Empty(t, pruneCandidates(map[string]bool{}, current))
+	// a source that failed to be sent is still current
+	assert.Equal(t, []string{"ns/b"}, pruneCandidates(previous, map[string]bool{"ns/a": false, "ns/c": true}))
+}
+
+func TestInventoryEncoding(t *testing.T) {
+	entries := map[string]bool{"ns/b": true, "ns/a": true}
+	value := encodeInventory(entries)
+	assert.Equal(t, "ns/a\nns/b", value)
+	assert.Equal(t, entries, decodeInventory(value))
+	assert.Empty(t, decodeInventory(""))
+	assert.NotEqual(t, inventoryKey(KindSecrets, "app=foo"), inventoryKey(KindSecrets, "app=bar"))
+}
+
+func TestInventoryPruneDryRun(t *testing.T) {
+	defer keepRepositoryCalls()()
+	repo := RepositoryMock{}
+	appcontext.Current.Add(appcontext.Repository, repo)
+	config.DryRun = true
+	defer func() { config.DryRun = false }()
+	deletes := RepositoryDeleteCalls
+	inv := &inventory{entries: map[string]bool{"ns/old": true, "ns/keep": true}}
+	results, err := inv.prune(context.Background(), map[string]bool{"ns/keep": true, "ns/new": true})
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, "old", results[0].Name)
+	assert.Equal(t, deletes, RepositoryDeleteCalls)
+	assert.Equal(t, map[string]bool{"ns/keep": true, "ns/new": true}, inv.entries)
+}
+
+func TestInventoryPruneFailedPublish(t *testing.T) {
+	defer keepRepositoryCalls()()
+	repo := RepositoryMock{}
+	appcontext.Current.Add(appcontext.Repository, repo)
+	config.DryRun = true
+	defer func() { config.DryRun = false }()
+	inv := &inventory{entries: map[string]bool{"ns/old": true, "ns/failed-again": true}}
+	results, err := inv.prune(context.Background(), map[string]bool{"ns/failed-again": false, "ns/never-sent": false, "ns/new": true})
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+	assert.Equal(t, "old", results[0].Name)
+	assert.Equal(t, map[string]bool{"ns/failed-again": true, "ns/new": true}, inv.entries)
+}
+
+func TestWithOwner(t *testing.T) {
+	labels := map[string]string{"app": "foo"}
+	assert.Equal(t, labels, withOwner(labels))
+	config.PublisherID = "cluster-a"
+	defer func() { config.PublisherID = "" }()
+	owned := withOwner(labels)
+	assert.Equal(t, "cluster-a", owned[ownerLabel])
+	assert.NotContains(t, labels, ownerLabel)
+}
+
+func TestValidatePrune(t *testing.T) {
+	assert.NoError(t, validatePrune())
+	config.Prune = true
+	defer func() { config.Prune = false }()
+	assert.Error(t, validatePrune())
+	config.PublisherID = "cluster-a"
+	defer func() { config.PublisherID = "" }()
+	config.SecretNamespace = "default"
+	assert.NoError(t, validatePrune())
+}
@@ -0,0 +1,91 @@
+package usecase
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/betorvs/secretpublisher/utils"
+	"gopkg.in/yaml.v2"
+)
+
+// LoadReceivers func reads the receivers in config.ReceiversFile, nil without it.
+// config.Quorum replaces the quorum in the file and receivers with keyringFile get its keyring.
+func LoadReceivers() (*domain.Receivers, error) {
+	if config.ReceiversFile == "" {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(config.ReceiversFile)
+	if err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
+	receivers, err := parseReceivers(content)
+	if err != nil {
+		return nil, utils.ErrorHandler(fmt.Errorf("%s: %v", config.ReceiversFile, err))
+	}
+	if config.Quorum != "" {
+		receivers.Quorum = config.Quorum
+	}
+	if _, err := domain.QuorumSize(receivers.Quorum, len(receivers.Receivers)); err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
+	for _, receiver := range receivers.Receivers {
+		if receiver.KeyringFile == "" {
+			continue
+		}
+		read := receiverKeyringReader(receiver)
+		receiver.Keyring, err = read()
+		if err != nil {
+			return nil, utils.ErrorHandler(err)
+		}
+		loadedKeyrings[fmt.Sprintf("receiver %s keyring", receiver.Name)] = loadedKeyring{keyring: receiver.Keyring, read: read}
+	}
+	return receivers, nil
+}
+
+// receiverKeyringReader func returns the func that reads the keyringFile of receiver
+func receiverKeyringReader(receiver *domain.Receiver) func() (*domain.Keyring, error) {
+	return func() (*domain.Keyring, error) {
+		content, err := ioutil.ReadFile(receiver.KeyringFile)
+		if err != nil {
+			return nil, err
+		}
+		keyring, err := parseKeyring(content)
+		if err != nil {
+			return nil, fmt.Errorf("receiver %s: %v", receiver.Name, err)
+		}
+		return keyring, nil
+	}
+}
+
+// parseReceivers func reads the receivers file in YAML or JSON, every receiver needs
+// a unique name and a URL
+func parseReceivers(content []byte) (*domain.Receivers, error) {
+	receivers := &domain.Receivers{}
+	if err := yaml.UnmarshalStrict(content, receivers); err != nil {
+		return nil, fmt.Errorf("cannot parse receivers: %v", err)
+	}
+	if len(receivers.Receivers) == 0 {
+		return nil, fmt.Errorf("no receivers")
+	}
+	seen := make(map[string]bool)
+	for i, receiver := range receivers.Receivers {
+		if receiver == nil || receiver.Name == "" || receiver.URL == "" {
+			return nil, fmt.Errorf("receiver %d needs name and url", i+1)
+		}
+		if seen[receiver.Name] {
+			return nil, fmt.Errorf("receiver %s is duplicated", receiver.Name)
+		}
+		seen[receiver.Name] = true
+		switch receiver.SigningMode {
+		case "", "hmac", "ed25519":
+		default:
+			return nil, fmt.Errorf("receiver %s: signingMode must be hmac or ed25519, got %q", receiver.Name, receiver.SigningMode)
+		}
+		if receiver.TLS != nil && (receiver.TLS.CertFile == "") != (receiver.TLS.KeyFile == "") {
+			return nil, fmt.Errorf("receiver %s: tls certFile and keyFile must be used together", receiver.Name)
+		}
+	}
+	return receivers, nil
+}
@@ -0,0 +1,57 @@
+package usecase
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReceivers(t *testing.T) {
+	receivers, err := parseReceivers([]byte("quorum: majority\nreceivers:\n- name: a\n  url: https://a.internal/secret\n  namespaces:\n    default: prod\n- name: b\n  url: vault://b.internal:8200/secret\n  tls:\n    caFile: ca.crt\n"))
+	assert.NoError(t, err)
+	assert.Len(t, receivers.Receivers, 2)
+	assert.Equal(t, "majority", receivers.Quorum)
+	assert.Equal(t, "prod", receivers.Receivers[0].Namespaces["default"])
+	assert.Equal(t, "ca.crt", receivers.Receivers[1].TLS.CAFile)
+
+	_, err = parseReceivers([]byte("receivers: []\n"))
+	assert.Error(t, err)
+	_, err = parseReceivers([]byte("receivers:\n- name: a\n"))
+	assert.Error(t, err)
+	_, err = parseReceivers([]byte("receivers:\n- name: a\n  url: http://a\n- name: a\n  url: http://b\n"))
+	assert.Error(t, err)
+	_, err = parseReceivers([]byte("receivers:\n- name: a\n  url: http://a\n  signingMode: rsa\n"))
+	assert.Error(t, err)
+	_, err = parseReceivers([]byte("receivers:\n- name: a\n  url: http://a\n  tls:\n    certFile: a.crt\n"))
+	assert.Error(t, err)
+	_, err = parseReceivers([]byte("receivers:\n- name: a\n  uri: http://a\n"))
+	assert.Error(t, err)
+}
+
+func TestLoadReceivers(t *testing.T) {
+	receivers, err := LoadReceivers()
+	assert.NoError(t, err)
+	assert.Nil(t, receivers)
+
+	dir := t.TempDir()
+	keyringFile := filepath.Join(dir, "keyring.yaml")
+	assert.NoError(t, ioutil.WriteFile(keyringFile, []byte("keys:\n- id: a1\n  secret: s\n"), 0600))
+	config.ReceiversFile = filepath.Join(dir, "receivers.yaml")
+	defer func() { config.ReceiversFile, config.Quorum = "", "" }()
+	assert.NoError(t, ioutil.WriteFile(config.ReceiversFile, []byte("receivers:\n- name: a\n  url: http://a\n  keyringFile: "+keyringFile+"\n- name: b\n  url: http://b\n"), 0600))
+	receivers, err = LoadReceivers()
+	assert.NoError(t, err)
+	assert.Equal(t, "a1", receivers.Receivers[0].Keyring.Keys[0].ID)
+	assert.Nil(t, receivers.Receivers[1].Keyring)
+
+	config.Quorum = "3"
+	_, err = LoadReceivers()
+	assert.Error(t, err)
+	config.Quorum = "1"
+	receivers, err = LoadReceivers()
+	assert.NoError(t, err)
+	assert.Equal(t, "1", receivers.Quorum)
+}
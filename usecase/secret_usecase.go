@@ -1,84 +1,155 @@
 package usecase
 
 import (
+	"context"
+	"crypto/hmac"
 	"crypto/sha512"
-	"encoding/json"
+	"encoding/base64"
 	"fmt"
+	"io"
 	"strings"
+	"time"
 
 	"github.com/betorvs/secretpublisher/config"
 	"github.com/betorvs/secretpublisher/domain"
 	"github.com/betorvs/secretpublisher/gateway/kubeclient"
 	"github.com/betorvs/secretpublisher/utils"
 	"gopkg.in/yaml.v2"
+	v1 "k8s.io/api/core/v1"
 )
 
 // GenerateSecret func uses generates a secret struct from flags
 func GenerateSecret(secretName string) *domain.Secret {
-	var checksum string
-	for _, v := range config.StringData {
-		checksum += v
-	}
 	secret := &domain.Secret{
 		Name:        secretName,
 		Namespace:   config.SecretNamespace,
-		Checksum:    createCheckSum(checksum),
 		Data:        config.StringData,
+		BinaryData:  binaryData,
 		Labels:      config.Labels,
 		Annotations: config.Annotations,
 	}
+	setChecksum(secret)
 	return secret
 }
 
-// ManageSecret func
-func ManageSecret(secretName string, secret *domain.Secret) error {
+// ManageSecret func creates, updates or skips a secret and returns the result
+func ManageSecret(ctx context.Context, secretName string, secret *domain.Secret) (*domain.Result, error) {
+	return manageSecret(ctx, utils.Out(), secretName, secret)
+}
+
+// NewResult func returns the result of one command for one secret, started at start
+func NewResult(secretName, namespace, action string, start time.Time, err error) *domain.Result {
+	result := &domain.Result{
+		Name:       secretName,
+		Namespace:  namespace,
+		Action:     action,
+		DryRun:     config.DryRun,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Action = domain.ActionFailed
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// manageSecret func creates, updates or skips a secret, printing to out, and returns the result.
+// With config.DryRun it only prints the plan. With many receivers it runs in each one, see manageTargets.
+func manageSecret(ctx context.Context, out io.Writer, secretName string, secret *domain.Secret) (*domain.Result, error) {
+	repo := domain.GetRepository()
+	if fanout, ok := repo.(domain.Fanout); ok {
+		return manageTargets(ctx, out, fanout, secretName, secret)
+	}
+	return manageSecretIn(ctx, out, repo, secretName, secret)
+}
+
+// manageSecretIn func does the work of manageSecret in one repository
+func manageSecretIn(ctx context.Context, out io.Writer, repo domain.Repository, secretName string, secret *domain.Secret) (*domain.Result, error) {
+	start := time.Now()
+	var before string
+	action, err := manageSecretAction(ctx, out, repo, secretName, secret, &before)
+	result := NewResult(secretName, secret.Namespace, action, start, err)
+	result.ChecksumBefore = before
+	switch {
+	case err != nil:
+	case action == domain.ActionUnchanged:
+		result.ChecksumAfter = before
+	default:
+		result.ChecksumAfter = secret.Checksum
+	}
+	return result, err
+}
+
+// manageSecretAction func does the work of manageSecret and returns the action taken,
+// keeping the checksum found in Secret Receiver in before
+func manageSecretAction(ctx context.Context, out io.Writer, repo domain.Repository, secretName string, secret *domain.Secret, before *string) (string, error) {
 	// check if secret exist
-	test := secret.Checksum
-	res, err := CheckSecret(secretName, secret.Namespace)
+	status, err := checkSecret(ctx, repo, secretName, secret.Namespace)
 	if err != nil {
-		return err
+		return domain.ActionFailed, err
 	}
-	if res != "notFound" {
+	if status.Found {
+		*before = status.Checksum
 		if config.Debug {
-			fmt.Printf("[DEBUG] Checking %s, %s, %s ", secretName, config.SecretNamespace, res)
+			fmt.Fprintf(out, "[DEBUG] Checking %s, %s, %s ", secretName, secret.Namespace, status.Checksum)
 		}
-		parsedRes := utils.RemoveQuotes(res)
-		if test == parsedRes {
-			fmt.Printf("[OK] Secret %s already exist\n", secretName)
-		} else {
-			if config.Debug {
-				fmt.Println("[DEBUG] Updating")
-			}
-			errUpdate := UpdateSecret(secretName, secret)
-			if errUpdate != nil {
-				return errUpdate
+		if checksumMatches(status.Checksum, secret) {
+			if config.DryRun {
+				printPlan(out, domain.ActionUnchanged, secret, nil)
+				return domain.ActionUnchanged, nil
 			}
-			fmt.Println("[OK] Updated")
+			fmt.Fprintf(out, "[OK] Secret %s already exist\n", secretName)
+			return domain.ActionUnchanged, nil
+		}
+		migrates := checksumMigrates(status.Checksum, secret)
+		if config.DryRun {
+			printPlan(out, domain.ActionUpdated, secret, status.Secret)
+			return domain.ActionUpdated, nil
 		}
-	} else {
 		if config.Debug {
-			fmt.Println("[DEBUG] Creating")
+			fmt.Fprintln(out, "[DEBUG] Updating")
 		}
-		errCreate := CreateSecret(secretName, secret)
-		if errCreate != nil {
-			return errCreate
+		secret.Name = secretName
+		errUpdate := updateSecret(ctx, repo, secret)
+		if errUpdate != nil {
+			return domain.ActionFailed, errUpdate
 		}
-		fmt.Println("[OK] Created")
+		if migrates {
+			fmt.Fprintf(out, "[OK] Updated with checksum %s\n", secret.ChecksumVersion)
+			return domain.ActionUpdated, nil
+		}
+		fmt.Fprintln(out, "[OK] Updated")
+		return domain.ActionUpdated, nil
 	}
-	return nil
-
+	if config.DryRun {
+		printPlan(out, domain.ActionCreated, secret, nil)
+		return domain.ActionCreated, nil
+	}
+	if config.Debug {
+		fmt.Fprintln(out, "[DEBUG] Creating")
+	}
+	secret.Name = secretName
+	errCreate := createSecret(ctx, repo, secret)
+	if errCreate != nil {
+		return domain.ActionFailed, errCreate
+	}
+	fmt.Fprintln(out, "[OK] Created")
+	return domain.ActionCreated, nil
 }
 
 // CreateSecret func
-func CreateSecret(secretName string, secret *domain.Secret) error {
-	secretClient := domain.GetRepository()
-	bodymarshal, err := json.Marshal(&secret)
+func CreateSecret(ctx context.Context, secretName string, secret *domain.Secret) error {
+	secret.Name = secretName
+	return createSecret(ctx, domain.GetRepository(), secret)
+}
+
+// createSecret func encrypts the secret when configured and creates it in repo
+func createSecret(ctx context.Context, repo domain.Repository, secret *domain.Secret) error {
+	payload, err := encryptPayload(secret)
 	if err != nil {
-		errlocal := utils.ErrorHandler(err)
-		return errlocal
+		return utils.ErrorHandler(err)
 	}
-	method := "POST"
-	errGateway := secretClient.PostOrPUTSecret(method, secretName, bodymarshal)
+	errGateway := repo.CreateSecret(ctx, payload)
 	if errGateway != nil {
 		errlocal := utils.ErrorHandler(errGateway)
 		return errlocal
@@ -87,15 +158,18 @@ func CreateSecret(secretName string, secret *domain.Secret) error {
 }
 
 // UpdateSecret func
-func UpdateSecret(secretName string, secret *domain.Secret) error {
-	secretClient := domain.GetRepository()
-	bodymarshal, err := json.Marshal(&secret)
+func UpdateSecret(ctx context.Context, secretName string, secret *domain.Secret) error {
+	secret.Name = secretName
+	return updateSecret(ctx, domain.GetRepository(), secret)
+}
+
+// updateSecret func encrypts the secret when configured and updates it in repo
+func updateSecret(ctx context.Context, repo domain.Repository, secret *domain.Secret) error {
+	payload, err := encryptPayload(secret)
 	if err != nil {
-		errlocal := utils.ErrorHandler(err)
-		return errlocal
+		return utils.ErrorHandler(err)
 	}
-	method := "PUT"
-	errGateway := secretClient.PostOrPUTSecret(method, secretName, bodymarshal)
+	errGateway := repo.UpdateSecret(ctx, payload)
 	if errGateway != nil {
 		errlocal := utils.ErrorHandler(errGateway)
 		return errlocal
@@ -104,21 +178,33 @@ func UpdateSecret(secretName string, secret *domain.Secret) error {
 }
 
 // CheckSecret func
-func CheckSecret(secretName, namespace string) (string, error) {
-	secretClient := domain.GetRepository()
-	res, errGateway := secretClient.GetSecretByName(secretName, namespace)
+func CheckSecret(ctx context.Context, secretName, namespace string) (*domain.SecretStatus, error) {
+	return checkSecret(ctx, domain.GetRepository(), secretName, namespace)
+}
+
+// checkSecret func returns the secret status in repo
+func checkSecret(ctx context.Context, repo domain.Repository, secretName, namespace string) (*domain.SecretStatus, error) {
+	status, errGateway := repo.GetSecret(ctx, secretName, namespace)
 	if errGateway != nil {
 		errlocal := utils.ErrorHandler(errGateway)
-		return "", errlocal
+		return nil, errlocal
 	}
-	// fmt.Printf("%s", res)
-	return res, nil
+	return status, nil
 }
 
 // DeleteSecret func
-func DeleteSecret(secretName string) error {
+func DeleteSecret(ctx context.Context, secretName string) error {
+	return deleteSecret(ctx, utils.Out(), secretName, config.SecretNamespace)
+}
+
+// deleteSecret func deletes a secret from a namespace, in dry run mode it only prints the plan to out
+func deleteSecret(ctx context.Context, out io.Writer, secretName, namespace string) error {
+	if config.DryRun {
+		printPlan(out, domain.ActionDeleted, &domain.Secret{Name: secretName, Namespace: namespace}, nil)
+		return nil
+	}
 	secretClient := domain.GetRepository()
-	errGateway := secretClient.DeleteSecretK8S(secretName, config.SecretNamespace)
+	errGateway := secretClient.DeleteSecret(ctx, secretName, namespace)
 	if errGateway != nil {
 		errlocal := utils.ErrorHandler(errGateway)
 		return errlocal
@@ -126,11 +212,30 @@ func DeleteSecret(secretName string) error {
 	return nil
 }
 
+// retryCount func returns how many requests the repository retried so far
+func retryCount() int64 {
+	if retrier, ok := domain.GetRepository().(domain.Retrier); ok {
+		return retrier.RetryCount()
+	}
+	return 0
+}
+
+// printRetries func prints the requests retried since retryCount returned before
+func printRetries(before int64) {
+	if retries := retryCount() - before; retries > 0 {
+		fmt.Fprintf(utils.Out(), "[INFO] Retried %d requests to Secret Receiver\n", retries)
+	}
+}
+
 // createCheckSum func
 // Create a shasum hash similar to
 // echo -n "value" | shasum -a 512
+// or an HMAC-SHA512 when LoadEncryptionKey loaded a checksum key
 func createCheckSum(value string) string {
 	shasum := sha512.New()
+	if checksumKey != nil {
+		shasum = hmac.New(sha512.New, checksumKey)
+	}
 	_, err := shasum.Write([]byte(value))
 	if err != nil {
 		return ""
@@ -140,185 +245,298 @@ func createCheckSum(value string) string {
 }
 
 // ScanSecret func
-func ScanSecret(labels string) (string, error) {
+func ScanSecret(ctx context.Context, labels string) (*domain.Report, error) {
+	retries := retryCount()
+	defer printRetries(retries)
+	if err := validatePrune(); err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
 	res, errGateway := kubeclient.GetSecrets(config.SecretNamespace, labels)
 	if errGateway != nil {
 		errlocal := utils.ErrorHandler(errGateway)
-		return "", errlocal
+		return nil, errlocal
 	}
 	// create a loop to check using manage secret
-	if len(res.Items) == 0 {
-		return fmt.Sprintf("Secrets with label %s not found\n", labels), nil
+	if len(res.Items) == 0 && !config.Prune {
+		return newReport(fmt.Sprintf("Secrets with label %s not found\n", labels), nil, retries), nil
 	}
-	var countErrors int
 	var countErrorsNames []string
+	current := make(map[string]bool)
+	secrets := make([]*domain.Secret, 0, len(res.Items))
 	for _, item := range res.Items {
-		data := make(map[string]string)
-		for k, v := range item.Data {
-			data[k] = string(v)
-		}
-		destination := config.DestinationNamespace
-		if destination == "" {
-			destination = item.Namespace
-		}
-		name := item.Name
-		if config.NameSuffix != "" {
-			name = fmt.Sprintf("%s-%s", item.Name, config.NameSuffix)
-		}
-		newSecret := rewriteSecret(name, destination, data, item.Labels, item.Annotations)
-		err := ManageSecret(name, newSecret)
+		newSecret := secretFromSecret(item)
+		current[secretKey(newSecret)] = false
+		secrets = append(secrets, newSecret)
+	}
+	results, errs := manageSecrets(ctx, secrets)
+	for i, err := range errs {
+		results[i].Source = sourceName(KindSecrets, res.Items[i].Namespace, res.Items[i].Name)
+		current[secretKey(secrets[i])] = err == nil
 		if err != nil {
-			countErrors++
-			countErrorsNames = append(countErrorsNames, item.Name)
+			countErrorsNames = append(countErrorsNames, res.Items[i].Name)
 		}
 	}
-	if countErrors != 0 {
-		return "NOK", fmt.Errorf("Cannot process these secrets: %v", countErrorsNames)
+	pruned, errPrune := pruneScan(ctx, KindSecrets, labels, current)
+	report := newReport("OK", append(results, pruned...), retries)
+	if errPrune != nil {
+		report.Message = "NOK"
+		return report, errPrune
+	}
+	if len(countErrorsNames) != 0 {
+		report.Message = "NOK"
+		return report, fmt.Errorf("Cannot process these secrets: %v", countErrorsNames)
 	}
-	return "OK", nil
+	return report, nil
 }
 
 // ScanConfigMap func
-func ScanConfigMap(labels string) (string, error) {
+func ScanConfigMap(ctx context.Context, labels string) (*domain.Report, error) {
+	retries := retryCount()
+	defer printRetries(retries)
+	if err := validatePrune(); err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
 	res, errGateway := kubeclient.GetConfigMaps(config.SecretNamespace, labels)
 	if errGateway != nil {
 		errlocal := utils.ErrorHandler(errGateway)
-		return "", errlocal
+		return nil, errlocal
 	}
-	var countErrors int
 	var countErrorsNames []string
+	current := make(map[string]bool)
+	secrets := make([]*domain.Secret, 0, len(res.Items))
 	for _, item := range res.Items {
-		data := make(map[string]string)
-		for k, v := range item.Data {
-			data[k] = string(v)
-		}
-		destination := config.DestinationNamespace
-		if destination == "" {
-			destination = item.Namespace
-		}
-		name := item.Name
-		if config.NameSuffix != "" {
-			name = fmt.Sprintf("%s-%s", item.Name, config.NameSuffix)
-		}
-		newSecret := rewriteSecret(name, destination, data, item.Labels, item.Annotations)
-		err := ManageSecret(name, newSecret)
+		newSecret := secretFromConfigMap(item)
+		current[secretKey(newSecret)] = false
+		secrets = append(secrets, newSecret)
+	}
+	results, errs := manageSecrets(ctx, secrets)
+	for i, err := range errs {
+		results[i].Source = sourceName(KindConfigMaps, res.Items[i].Namespace, res.Items[i].Name)
+		current[secretKey(secrets[i])] = err == nil
 		if err != nil {
-			countErrors++
-			countErrorsNames = append(countErrorsNames, item.Name)
+			countErrorsNames = append(countErrorsNames, res.Items[i].Name)
 		}
 	}
-	if countErrors != 0 {
-		return "NOK", fmt.Errorf("Cannot process these config maps: %v", countErrorsNames)
+	pruned, errPrune := pruneScan(ctx, KindConfigMaps, labels, current)
+	report := newReport("OK", append(results, pruned...), retries)
+	if errPrune != nil {
+		report.Message = "NOK"
+		return report, errPrune
+	}
+	if len(countErrorsNames) != 0 {
+		report.Message = "NOK"
+		return report, fmt.Errorf("Cannot process these config maps: %v", countErrorsNames)
+	}
+	return report, nil
+}
+
+// newReport func returns a report with the requests retried since retryCount returned retries
+func newReport(message string, results []*domain.Result, retries int64) *domain.Report {
+	if results == nil {
+		results = []*domain.Result{}
+	}
+	return &domain.Report{
+		Message: message,
+		Results: results,
+		Retries: retryCount() - retries,
 	}
-	return "OK", nil
 }
 
-// local rewrite func to rewrite secret and config map from K8S
-func rewriteSecret(secretName, namespace string, data, labels, annotations map[string]string) *domain.Secret {
-	var checksum string
-	for _, v := range data {
-		checksum += v
+// sourceName func returns kind/namespace/name of a kubernetes object
+func sourceName(kind, namespace, name string) string {
+	return fmt.Sprintf("%s/%s/%s", kind, namespace, name)
+}
+
+// secretFromSecret func converts a kubernetes secret into the secret sent to Secret Receiver,
+// keeping its type and immutable. Values that are not valid UTF-8 go to BinaryData.
+func secretFromSecret(item v1.Secret) *domain.Secret {
+	secret := &domain.Secret{
+		Name:        destinationName(item.Name),
+		Namespace:   destinationNamespace(item.Namespace),
+		Type:        string(item.Type),
+		Immutable:   item.Immutable != nil && *item.Immutable,
+		Data:        make(map[string]string),
+		Labels:      item.Labels,
+		Annotations: item.Annotations,
+	}
+	for k, v := range item.Data {
+		secret.SetRawData(k, v)
 	}
+	return rewriteSecret(secret)
+}
+
+// secretFromConfigMap func converts a kubernetes config map into the secret sent to Secret Receiver,
+// with its binaryData base64 encoded in BinaryData
+func secretFromConfigMap(item v1.ConfigMap) *domain.Secret {
 	secret := &domain.Secret{
-		Name:        secretName,
-		Namespace:   namespace,
-		Checksum:    createCheckSum(checksum),
-		Data:        data,
-		Labels:      labels,
-		Annotations: annotations,
+		Name:        destinationName(item.Name),
+		Namespace:   destinationNamespace(item.Namespace),
+		Immutable:   item.Immutable != nil && *item.Immutable,
+		Data:        make(map[string]string),
+		Labels:      item.Labels,
+		Annotations: item.Annotations,
+	}
+	for k, v := range item.Data {
+		secret.Data[k] = v
 	}
+	for k, v := range item.BinaryData {
+		if secret.BinaryData == nil {
+			secret.BinaryData = make(map[string]string)
+		}
+		secret.BinaryData[k] = base64.StdEncoding.EncodeToString(v)
+	}
+	return rewriteSecret(secret)
+}
+
+// destinationNamespace func returns config.DestinationNamespace or the source namespace
+func destinationNamespace(namespace string) string {
+	if config.DestinationNamespace != "" {
+		return config.DestinationNamespace
+	}
+	return namespace
+}
+
+// destinationName func appends config.NameSuffix to a name
+func destinationName(name string) string {
+	if config.NameSuffix != "" {
+		return fmt.Sprintf("%s-%s", name, config.NameSuffix)
+	}
+	return name
+}
+
+// local rewrite func adds the owner label to secrets from K8S and files and sets the checksum
+func rewriteSecret(secret *domain.Secret) *domain.Secret {
+	secret.Labels = withOwner(secret.Labels)
+	setChecksum(secret)
 	return secret
 }
 
 // ScanSubvalueSecret func
-func ScanSubvalueSecret(labels string) (string, error) {
+func ScanSubvalueSecret(ctx context.Context, labels string) (*domain.Report, error) {
+	retries := retryCount()
+	defer printRetries(retries)
+	if err := validatePrune(); err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
 	res, errGateway := kubeclient.GetSecrets(config.SecretNamespace, labels)
 	if errGateway != nil {
 		errlocal := utils.ErrorHandler(errGateway)
-		return "", errlocal
+		return nil, errlocal
 	}
 	// create a loop to check using manage secret
-	if len(res.Items) == 0 {
-		return fmt.Sprintf("Secrets with label %s not found\n", labels), nil
+	if len(res.Items) == 0 && !config.Prune {
+		return newReport(fmt.Sprintf("Secrets with label %s not found\n", labels), nil, retries), nil
 	}
-	var countErrors int
-	var countErrorsNames []string
-	for _, item := range res.Items {
-		if config.DisabledLabel != "" {
-			if searchLabels(config.DisabledLabel, item.Labels) {
-				fmt.Printf("Skiping secret %s \n", item.Name)
-				continue
-			}
-		}
-		data := make(map[string]string)
-		var suffixName, key, subkey string
-		if strings.Contains(config.MatchKey, ".") {
-			splited := strings.Split(config.MatchKey, ".")
-			key = splited[0]
-			subkey = splited[1]
+	secrets, sources, current, countErrorsNames := subvalueSecrets(res.Items)
+	results, errs := manageSecrets(ctx, secrets)
+	for i, err := range errs {
+		results[i].Source = sourceName(KindSecrets, sources[i].Namespace, sources[i].Name)
+		current[secretKey(secrets[i])] = err == nil
+		if err != nil {
+			countErrorsNames = append(countErrorsNames, sources[i].Name)
 		}
-		for k, v := range item.Data {
-			if k == config.KeyNameSuffix {
-				suffixName = string(v)
-			}
-			if k == key {
-				// fmt.Println(k)
-				temp := make(map[string]string)
-				err := yaml.Unmarshal(v, &temp)
-				if err != nil {
-					fmt.Println("fail in Unmarshal")
-					countErrors++
-				}
-				// fmt.Println(temp)
-				// if subkey is not empty
-				if subkey != "" {
-					data[subkey] = temp[subkey]
-				}
-			}
+	}
+	pruned, errPrune := pruneScan(ctx, KindSubvalue, labels, current)
+	report := newReport("OK", append(results, pruned...), retries)
+	if errPrune != nil {
+		report.Message = "NOK"
+		return report, errPrune
+	}
+	if len(countErrorsNames) != 0 {
+		report.Message = "NOK"
+		return report, fmt.Errorf("Cannot process these secrets: %v", countErrorsNames)
+	}
+	return report, nil
+}
 
+// subvalueSecrets func returns the secrets to send for items with their sources, current with
+// the key of every item for prune, false until it is sent, and the names of items that cannot be
+// unmarshalled. Items with config.DisabledLabel or that cannot be unmarshalled are not sent but
+// stay in current, so prune keeps the copy already in Secret Receiver. Watch mode skips them too.
+func subvalueSecrets(items []v1.Secret) ([]*domain.Secret, []v1.Secret, map[string]bool, []string) {
+	var errorNames []string
+	current := make(map[string]bool)
+	var secrets []*domain.Secret
+	var sources []v1.Secret
+	for _, item := range items {
+		if subvalueDisabled(item) {
+			fmt.Fprintf(utils.Out(), "Skiping secret %s \n", item.Name)
+			current[subvalueKey(item)] = false
+			continue
 		}
-		destination := config.DestinationNamespace
-		if destination == "" {
-			destination = item.Namespace
+		newSecret, errSubvalue := subvalueSecret(item)
+		current[secretKey(newSecret)] = false
+		if errSubvalue != nil {
+			fmt.Fprintf(utils.Out(), "[ERROR] Secret %s in namespace %s: %v\n", item.Name, item.Namespace, errSubvalue)
+			errorNames = append(errorNames, item.Name)
+			continue
 		}
-		labels := make(map[string]string)
-		if config.NewLabels != "" {
-			if strings.Contains(config.NewLabels, "=") {
-				splited := strings.Split(config.NewLabels, "=")
-				labels[splited[0]] = splited[1]
-			}
+		secrets = append(secrets, newSecret)
+		sources = append(sources, item)
+	}
+	return secrets, sources, current, errorNames
+}
+
+// subvalueKey func returns namespace/name of the secret sent for item, the name does not depend on its data
+func subvalueKey(item v1.Secret) string {
+	secret, _ := subvalueSecret(item)
+	return secretKey(secret)
+}
+
+// subvalueDisabled func returns true when the secret has config.DisabledLabel
+func subvalueDisabled(item v1.Secret) bool {
+	return config.DisabledLabel != "" && searchLabels(config.DisabledLabel, item.Labels)
+}
+
+// subvalueSecret func creates a secret with only config.MatchKey subkey from a kubernetes secret.
+// The secret is returned even when the key cannot be unmarshalled, with an empty value.
+func subvalueSecret(item v1.Secret) (*domain.Secret, error) {
+	var errUnmarshal error
+	data := make(map[string]string)
+	var suffixName, key, subkey string
+	if strings.Contains(config.MatchKey, ".") {
+		splited := strings.Split(config.MatchKey, ".")
+		key = splited[0]
+		subkey = splited[1]
+	}
+	for k, v := range item.Data {
+		if k == config.KeyNameSuffix {
+			suffixName = string(v)
 		}
-		annotations := make(map[string]string)
-		if config.NewAnnotations != "" {
-			if strings.Contains(config.NewAnnotations, "=") {
-				splited := strings.Split(config.NewAnnotations, "=")
-				annotations[splited[0]] = splited[1]
+		if k == key {
+			temp := make(map[string]string)
+			err := yaml.Unmarshal(v, &temp)
+			if err != nil {
+				errUnmarshal = fmt.Errorf("cannot unmarshal key %s: %v", key, err)
+			}
+			// if subkey is not empty
+			if subkey != "" {
+				data[subkey] = temp[subkey]
 			}
 		}
-		name := fmt.Sprintf("%s-%s-%s", item.Name, subkey, suffixName)
-		if config.NameSuffix != "" {
-			name = fmt.Sprintf("%s-%s-%s-%s", item.Name, subkey, suffixName, config.NameSuffix)
-		}
-		localName := fmt.Sprintf("%s-%s", subkey, suffixName)
-		if config.MiddleName != "" {
-			localName = fmt.Sprintf("%s-%s-%s", subkey, config.MiddleName, suffixName)
-		}
-		// fmt.Println(localName)
-		localData := map[string]string{
-			localName: data[subkey],
-		}
-		// fmt.Println(localData)
-		newSecret := rewriteSecret(name, destination, localData, labels, annotations)
-		err := ManageSecret(name, newSecret)
-		if err != nil {
-			countErrors++
-			countErrorsNames = append(countErrorsNames, item.Name)
-		}
+
+	}
+	labels := config.ParseLabelsArg(config.NewLabels)
+	annotations := config.ParseLabelsArg(config.NewAnnotations)
+	name := fmt.Sprintf("%s-%s-%s", item.Name, subkey, suffixName)
+	if config.NameSuffix != "" {
+		name = fmt.Sprintf("%s-%s-%s-%s", item.Name, subkey, suffixName, config.NameSuffix)
+	}
+	localName := fmt.Sprintf("%s-%s", subkey, suffixName)
+	if config.MiddleName != "" {
+		localName = fmt.Sprintf("%s-%s-%s", subkey, config.MiddleName, suffixName)
+	}
+	localData := map[string]string{
+		localName: data[subkey],
 	}
-	if countErrors != 0 {
-		return "NOK", fmt.Errorf("Cannot process these secrets: %v", countErrorsNames)
+	secret := &domain.Secret{
+		Name:        name,
+		Namespace:   destinationNamespace(item.Namespace),
+		Data:        localData,
+		Labels:      labels,
+		Annotations: annotations,
 	}
-	return "OK", nil
+	return rewriteSecret(secret), errUnmarshal
 }
 
 func searchLabels(label string, labels map[string]string) bool {
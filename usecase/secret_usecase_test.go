@@ -1,17 +1,22 @@
 package usecase
 
 import (
+	"context"
+	"io/ioutil"
 	"testing"
 
 	"github.com/betorvs/secretpublisher/appcontext"
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
 	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 var (
 	RepositoryGetSecretByNameCalls int
 	RepositoryPostSecretCalls      int
 	RepositoryPUTSecretCalls       int
-	RepositoryPostOrPUTSecretCalls int
 	RepositoryDeleteCalls          int
 )
 
@@ -24,24 +29,22 @@ func TestCreateCheckSum(t *testing.T) {
 type RepositoryMock struct {
 }
 
-func (repo RepositoryMock) GetSecretByName(secret string, namespace string) (string, error) {
+func (repo RepositoryMock) GetSecret(ctx context.Context, name string, namespace string) (*domain.SecretStatus, error) {
 	RepositoryGetSecretByNameCalls++
-	return "notFound", nil
+	return &domain.SecretStatus{Found: false}, nil
 }
 
-func (repo RepositoryMock) PostOrPUTSecret(method string, secret string, body []byte) error {
-	switch method {
-	case "PUT":
-		RepositoryPUTSecretCalls++
-	case "POST":
-		RepositoryPostSecretCalls++
-	default:
-		RepositoryPostOrPUTSecretCalls++
-	}
+func (repo RepositoryMock) CreateSecret(ctx context.Context, secret *domain.Secret) error {
+	RepositoryPostSecretCalls++
+	return nil
+}
+
+func (repo RepositoryMock) UpdateSecret(ctx context.Context, secret *domain.Secret) error {
+	RepositoryPUTSecretCalls++
 	return nil
 }
 
-func (repo RepositoryMock) DeleteSecretK8S(secret string, namespace string) error {
+func (repo RepositoryMock) DeleteSecret(ctx context.Context, name string, namespace string) error {
 	RepositoryDeleteCalls++
 	return nil
 }
@@ -49,7 +52,7 @@ func (repo RepositoryMock) DeleteSecretK8S(secret string, namespace string) erro
 func TestCheckSecret(t *testing.T) {
 	repo := RepositoryMock{}
 	appcontext.Current.Add(appcontext.Repository, repo)
-	_, err := CheckSecret("foo", "default")
+	_, err := CheckSecret(context.Background(), "foo", "default")
 	assert.NoError(t, err)
 	expected := 1
 	if RepositoryGetSecretByNameCalls != expected {
@@ -61,7 +64,7 @@ func TestCreateSecret(t *testing.T) {
 	repo := RepositoryMock{}
 	appcontext.Current.Add(appcontext.Repository, repo)
 	secret := GenerateSecret("foo")
-	err := CreateSecret("foo", secret)
+	err := CreateSecret(context.Background(), "foo", secret)
 	assert.NoError(t, err)
 	expected := 1
 	if RepositoryPostSecretCalls != expected {
@@ -73,7 +76,7 @@ func TestUpdateSecret(t *testing.T) {
 	repo := RepositoryMock{}
 	appcontext.Current.Add(appcontext.Repository, repo)
 	secret := GenerateSecret("foo")
-	err := UpdateSecret("foo", secret)
+	err := UpdateSecret(context.Background(), "foo", secret)
 	assert.NoError(t, err)
 	expected := 1
 	if RepositoryPUTSecretCalls != expected {
@@ -84,7 +87,7 @@ func TestUpdateSecret(t *testing.T) {
 func TestDeleteSecret(t *testing.T) {
 	repo := RepositoryMock{}
 	appcontext.Current.Add(appcontext.Repository, repo)
-	err := DeleteSecret("foo")
+	err := DeleteSecret(context.Background(), "foo")
 	assert.NoError(t, err)
 	expected := 1
 	if RepositoryDeleteCalls != expected {
@@ -97,6 +100,87 @@ func TestManageSecret(t *testing.T) {
 	repo := RepositoryMock{}
 	appcontext.Current.Add(appcontext.Repository, repo)
 	secret := GenerateSecret("foo")
-	test := ManageSecret("foo", secret)
+	result, test := ManageSecret(context.Background(), "foo", secret)
 	assert.NoError(t, test)
+	assert.Equal(t, "foo", result.Name)
+}
+
+// keepRepositoryCalls saves the RepositoryMock counters and returns a func to restore them,
+// so tests in other files do not change the expected values above
+func keepRepositoryCalls() func() {
+	get, post, put, del := RepositoryGetSecretByNameCalls, RepositoryPostSecretCalls, RepositoryPUTSecretCalls, RepositoryDeleteCalls
+	return func() {
+		RepositoryGetSecretByNameCalls, RepositoryPostSecretCalls, RepositoryPUTSecretCalls, RepositoryDeleteCalls = get, post, put, del
+	}
+}
+
+func TestManageSecretDryRun(t *testing.T) {
+	defer keepRepositoryCalls()()
+	repo := RepositoryMock{}
+	appcontext.Current.Add(appcontext.Repository, repo)
+	config.DryRun = true
+	defer func() { config.DryRun = false }()
+	posts := RepositoryPostSecretCalls
+	secret := GenerateSecret("foo")
+	result, err := manageSecret(context.Background(), ioutil.Discard, "foo", secret)
+	assert.NoError(t, err)
+	assert.Equal(t, domain.ActionCreated, result.Action)
+	assert.True(t, result.DryRun)
+	assert.Equal(t, posts, RepositoryPostSecretCalls)
+}
+
+func TestSecretFromSecret(t *testing.T) {
+	immutable := true
+	item := v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "tls", Namespace: "default"},
+		Type:       v1.SecretTypeTLS,
+		Immutable:  &immutable,
+		Data:       map[string][]byte{"tls.crt": []byte("cert"), "keystore": {0xff, 0x00, 0xfe}},
+	}
+	secret := secretFromSecret(item)
+	assert.Equal(t, "kubernetes.io/tls", secret.Type)
+	assert.True(t, secret.Immutable)
+	assert.Equal(t, map[string]string{"tls.crt": "cert"}, secret.Data)
+	assert.Equal(t, map[string]string{"keystore": "/wD+"}, secret.BinaryData)
+	raw, err := secret.RawData()
+	assert.NoError(t, err)
+	assert.Equal(t, item.Data, raw)
+
+	configMap := v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Data:       map[string]string{"app.yaml": "key: value"},
+		BinaryData: map[string][]byte{"logo.png": {0x89, 0x50}},
+	}
+	secret = secretFromConfigMap(configMap)
+	assert.Equal(t, "", secret.Type)
+	assert.Equal(t, map[string]string{"app.yaml": "key: value"}, secret.Data)
+	assert.Equal(t, map[string]string{"logo.png": "iVA="}, secret.BinaryData)
+}
+
+func TestSubvalueSecrets(t *testing.T) {
+	config.MatchKey, config.KeyNameSuffix, config.DisabledLabel = "config.password", "env", "skip=true"
+	defer func() { config.MatchKey, config.KeyNameSuffix, config.DisabledLabel = "", "", "" }()
+	items := []v1.Secret{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+			Data:       map[string][]byte{"config": []byte("password: abc"), "env": []byte("prod")},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "old", Namespace: "default", Labels: map[string]string{"skip": "true"}},
+			Data:       map[string][]byte{"config": []byte("password: def"), "env": []byte("prod")},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "broken", Namespace: "default"},
+			Data:       map[string][]byte{"config": []byte("password: [abc"), "env": []byte("prod")},
+		},
+	}
+	secrets, sources, current, errs := subvalueSecrets(items)
+	// a secret that cannot be unmarshalled is skipped, not sent with an empty value
+	assert.Equal(t, []string{"broken"}, errs)
+	assert.Len(t, secrets, 1)
+	assert.Equal(t, "app-password-prod", secrets[0].Name)
+	assert.Equal(t, "abc", secrets[0].Data["password-prod"])
+	assert.Equal(t, "app", sources[0].Name)
+	// the disabled secret is not sent but it is kept by prune
+	assert.Equal(t, map[string]bool{"default/app-password-prod": false, "default/old-password-prod": false, "default/broken-password-prod": false}, current)
 }
@@ -0,0 +1,200 @@
+package usecase
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"gopkg.in/yaml.v2"
+)
+
+// validDataKey is the kubernetes rule for secret and config map keys
+var validDataKey = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+// binaryData is the BinaryData loaded by LoadStringData, from files that are not valid UTF-8
+var binaryData map[string]string
+
+// stringDataSet struct keeps secret data with the source of each key, to detect conflicts
+type stringDataSet struct {
+	// secret has Data and BinaryData only
+	secret  domain.Secret
+	sources map[string]string
+}
+
+// add func sets key from source, failing when another source set it already.
+// Values that are not valid UTF-8 go to BinaryData.
+func (s *stringDataSet) add(source, key string, value []byte) error {
+	if len(key) > 253 || key == "." || key == ".." || !validDataKey.MatchString(key) {
+		return fmt.Errorf("%s: invalid key %q, use letters, numbers, -, _ and .", source, key)
+	}
+	if previous, ok := s.sources[key]; ok {
+		return fmt.Errorf("key %q is set by %s and %s", key, previous, source)
+	}
+	s.secret.SetRawData(key, value)
+	s.sources[key] = source
+	return nil
+}
+
+// LoadStringData func merges --from-literal, --from-file, --from-env-file and --stdin values
+// into config.StringData, like kubectl create secret generic. Files that are not valid UTF-8
+// are kept as BinaryData of GenerateSecret. It fails when the same key comes from two sources,
+// --stringData included.
+func LoadStringData() error {
+	binaryData = nil
+	if len(config.FromLiterals) == 0 && len(config.FromFiles) == 0 && len(config.FromEnvFiles) == 0 && !config.Stdin {
+		return nil
+	}
+	data, binary, err := mergeStringData(config.StringData, os.Stdin)
+	if err != nil {
+		return err
+	}
+	config.StringData = data
+	binaryData = binary
+	return nil
+}
+
+// mergeStringData func returns stringData with the values of every source, reading stdin with --stdin,
+// and the base64 values that are not valid UTF-8
+func mergeStringData(stringData map[string]string, stdin io.Reader) (map[string]string, map[string]string, error) {
+	set := &stringDataSet{secret: domain.Secret{Data: make(map[string]string)}, sources: make(map[string]string)}
+	for k, v := range stringData {
+		set.secret.Data[k] = v
+		set.sources[k] = "--stringData"
+	}
+	for i, literal := range config.FromLiterals {
+		parts := strings.SplitN(literal, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			// without = the whole literal can be the secret, only its position is printed
+			return nil, nil, fmt.Errorf("--from-literal number %d must be key=value", i+1)
+		}
+		if err := set.add("--from-literal", parts[0], []byte(parts[1])); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, file := range config.FromFiles {
+		if err := addFromFile(set, file); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, file := range config.FromEnvFiles {
+		if err := addFromEnvFile(set, file); err != nil {
+			return nil, nil, err
+		}
+	}
+	if config.Stdin {
+		if err := addFromStdin(set, stdin); err != nil {
+			return nil, nil, err
+		}
+	}
+	return set.secret.Data, set.secret.BinaryData, nil
+}
+
+// addFromFile func adds [key=]path, the key is the file name by default. A directory adds
+// every regular file in it with a valid key name.
+func addFromFile(set *stringDataSet, arg string) error {
+	source := fmt.Sprintf("--from-file %s", arg)
+	key, path := "", arg
+	if parts := strings.SplitN(arg, "=", 2); len(parts) == 2 {
+		key, path = parts[0], parts[1]
+		if key == "" || path == "" {
+			return fmt.Errorf("--from-file must be [key=]path, got %q", arg)
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	if !info.IsDir() {
+		if key == "" {
+			key = filepath.Base(path)
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		return set.add(source, key, content)
+	}
+	if key != "" {
+		return fmt.Errorf("%s: key cannot be used with a directory", source)
+	}
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", source, err)
+	}
+	for _, file := range files {
+		if !file.Mode().IsRegular() || !validDataKey.MatchString(file.Name()) {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(path, file.Name()))
+		if err != nil {
+			return fmt.Errorf("%s: %w", source, err)
+		}
+		if err := set.add(source, file.Name(), content); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addFromEnvFile func adds the KEY=VALUE lines of file. Empty lines and lines starting with #
+// are skipped, a line with only KEY uses the environment variable KEY when it is set.
+func addFromEnvFile(set *stringDataSet, file string) error {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("--from-env-file %s: %w", file, err)
+	}
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(content)+1)
+	for number := 1; scanner.Scan(); number++ {
+		source := fmt.Sprintf("--from-env-file %s line %d", file, number)
+		line := strings.TrimLeft(scanner.Text(), " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if strings.ContainsAny(parts[0], " \t") {
+			return fmt.Errorf("%s: key %q must not contain spaces", source, parts[0])
+		}
+		if len(parts) == 1 {
+			value, ok := os.LookupEnv(parts[0])
+			if !ok {
+				continue
+			}
+			parts = append(parts, value)
+		}
+		if err := set.add(source, parts[0], []byte(parts[1])); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("--from-env-file %s: %w", file, err)
+	}
+	return nil
+}
+
+// addFromStdin func adds a JSON or YAML map read from stdin
+func addFromStdin(set *stringDataSet, stdin io.Reader) error {
+	content, err := ioutil.ReadAll(stdin)
+	if err != nil {
+		return fmt.Errorf("--stdin: %w", err)
+	}
+	data := make(map[string]string)
+	if err := yaml.UnmarshalStrict(content, &data); err != nil {
+		return fmt.Errorf("--stdin must be a JSON or YAML map of strings: %w", err)
+	}
+	for k, v := range data {
+		if err := set.add("--stdin", k, []byte(v)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package usecase
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func keepStringDataSources() func() {
+	literals, files, envFiles, stdin := config.FromLiterals, config.FromFiles, config.FromEnvFiles, config.Stdin
+	return func() {
+		config.FromLiterals, config.FromFiles, config.FromEnvFiles, config.Stdin = literals, files, envFiles, stdin
+	}
+}
+
+func TestMergeStringData(t *testing.T) {
+	defer keepStringDataSources()()
+	dir := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "tls.crt"), []byte("cert\n"), 0600))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "keys"), 0700))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "keys", "a.key"), []byte("a"), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "keys", "b key"), []byte("b"), 0600))
+	envFile := filepath.Join(dir, "app.env")
+	assert.NoError(t, ioutil.WriteFile(envFile, []byte("\xef\xbb\xbf# comment\n\nDB_URL=postgres://u:p@host/db?sslmode=require\n  EMPTY=\nFROM_ENV\nNOT_SET\n"), 0600))
+	t.Setenv("FROM_ENV", "env value")
+
+	config.FromLiterals = []string{"token=abc==", "list=a,b"}
+	config.FromFiles = []string{filepath.Join(dir, "tls.crt"), "ca=" + filepath.Join(dir, "tls.crt"), filepath.Join(dir, "keys")}
+	config.FromEnvFiles = []string{envFile}
+	config.Stdin = true
+	data, binary, err := mergeStringData(map[string]string{"user": "admin"}, strings.NewReader(`{"password": "s3cr=t", "port": 5432}`))
+	assert.NoError(t, err)
+	assert.Nil(t, binary)
+	expected := map[string]string{
+		"user":     "admin",
+		"token":    "abc==",
+		"list":     "a,b",
+		"tls.crt":  "cert\n",
+		"ca":       "cert\n",
+		"a.key":    "a",
+		"DB_URL":   "postgres://u:p@host/db?sslmode=require",
+		"EMPTY":    "",
+		"FROM_ENV": "env value",
+		"password": "s3cr=t",
+		"port":     "5432",
+	}
+	assert.Equal(t, expected, data)
+}
+
+func TestMergeStringDataBinary(t *testing.T) {
+	defer keepStringDataSources()()
+	dir := t.TempDir()
+	keystore := filepath.Join(dir, "keystore.jks")
+	assert.NoError(t, ioutil.WriteFile(keystore, []byte{0xfe, 0xed, 0xfe, 0xed, 0x00, 0x80, 0xff}, 0600))
+	config.FromLiterals, config.FromEnvFiles, config.Stdin = nil, nil, false
+	config.FromFiles = []string{keystore}
+	data, binary, err := mergeStringData(map[string]string{"user": "admin"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"user": "admin"}, data)
+	assert.Equal(t, map[string]string{"keystore.jks": "/u3+7QCA/w=="}, binary)
+
+	stringData := config.StringData
+	config.StringData = map[string]string{}
+	defer func() {
+		config.StringData = stringData
+		binaryData = nil
+	}()
+	assert.NoError(t, LoadStringData())
+	secret := GenerateSecret("keystore")
+	raw, err := secret.RawData()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xfe, 0xed, 0xfe, 0xed, 0x00, 0x80, 0xff}, raw["keystore.jks"])
+}
+
+func TestMergeStringDataErrors(t *testing.T) {
+	defer keepStringDataSources()()
+	dir := t.TempDir()
+	file := filepath.Join(dir, "user")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("root"), 0600))
+	config.FromFiles, config.FromEnvFiles, config.Stdin = nil, nil, false
+
+	config.FromLiterals = []string{"user=admin"}
+	_, _, err := mergeStringData(map[string]string{"user": "admin"}, nil)
+	assert.EqualError(t, err, `key "user" is set by --stringData and --from-literal`)
+
+	config.FromLiterals = []string{"user=admin", "s3cr3t"}
+	_, _, err = mergeStringData(nil, nil)
+	assert.EqualError(t, err, "--from-literal number 2 must be key=value")
+
+	config.FromLiterals = []string{"bad key=secret"}
+	_, _, err = mergeStringData(nil, nil)
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret")
+
+	config.FromLiterals = []string{"user=admin"}
+	config.FromFiles = []string{file}
+	_, _, err = mergeStringData(nil, nil)
+	assert.EqualError(t, err, `key "user" is set by --from-literal and --from-file `+file)
+
+	config.FromLiterals = nil
+	config.FromFiles = []string{"key=" + dir}
+	_, _, err = mergeStringData(nil, nil)
+	assert.Error(t, err)
+
+	config.FromFiles = []string{filepath.Join(dir, "missing")}
+	_, _, err = mergeStringData(nil, nil)
+	assert.Error(t, err)
+
+	config.FromFiles = nil
+	config.Stdin = true
+	_, _, err = mergeStringData(nil, strings.NewReader("user:\n  name: admin\n"))
+	assert.Error(t, err)
+}
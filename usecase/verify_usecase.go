@@ -0,0 +1,182 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/betorvs/secretpublisher/gateway/kubeclient"
+	"github.com/betorvs/secretpublisher/utils"
+)
+
+// verifySeverity orders verify actions, the worst one is the result of many receivers
+var verifySeverity = map[string]int{
+	domain.ActionInSync:  0,
+	domain.ActionDrifted: 1,
+	domain.ActionMissing: 2,
+	domain.ActionFailed:  3,
+}
+
+// verifySource is one secret created from a kubernetes object, err is set when it could not be created
+type verifySource struct {
+	source string
+	secret *domain.Secret
+	err    error
+}
+
+// Verify func compares the secrets created from kind objects with labels, like the scan commands,
+// with the secrets in Secret Receiver without writing anything. Each result is inSync, drifted,
+// missing or failed, with the checksum in Secret Receiver in ChecksumBefore and the expected one in
+// ChecksumAfter. It returns an error wrapping domain.ErrDrift when secrets are drifted or missing.
+// Secrets not compared yet when ctx is cancelled fail with its error.
+func Verify(ctx context.Context, kind, labels string) (*domain.Report, error) {
+	retries := retryCount()
+	defer printRetries(retries)
+	sources, err := verifySources(kind, labels)
+	if err != nil {
+		return nil, utils.ErrorHandler(err)
+	}
+	if len(sources) == 0 {
+		return newReport(fmt.Sprintf("Sources with label %s not found\n", labels), nil, retries), nil
+	}
+	results := make([]*domain.Result, len(sources))
+	runPool(concurrency(), len(sources), utils.Out(), func(i int, out io.Writer) error {
+		source := sources[i]
+		if source.err != nil {
+			results[i] = NewResult(source.secret.Name, source.secret.Namespace, domain.ActionFailed, time.Now(), source.err)
+			fmt.Fprintf(out, "[ERROR] Secret %s in namespace %s: %v\n", source.secret.Name, source.secret.Namespace, source.err)
+		} else {
+			results[i] = verifySecret(ctx, out, source.secret)
+		}
+		results[i].Source = source.source
+		return nil
+	})
+	counts := make(map[string]int)
+	var failed, drifted []string
+	for _, result := range results {
+		counts[result.Action]++
+		switch result.Action {
+		case domain.ActionFailed:
+			failed = append(failed, result.Name)
+		case domain.ActionDrifted, domain.ActionMissing:
+			drifted = append(drifted, result.Name)
+		}
+	}
+	message := fmt.Sprintf("%d in sync, %d drifted, %d missing, %d failed\n", counts[domain.ActionInSync], counts[domain.ActionDrifted], counts[domain.ActionMissing], counts[domain.ActionFailed])
+	report := newReport(message, results, retries)
+	if len(failed) != 0 {
+		return report, fmt.Errorf("Cannot verify these secrets: %v", failed)
+	}
+	if len(drifted) != 0 {
+		return report, fmt.Errorf("%w in these secrets: %v", domain.ErrDrift, drifted)
+	}
+	return report, nil
+}
+
+// verifySources func returns the secrets created from kind objects with labels, like the scan commands do
+func verifySources(kind, labels string) ([]*verifySource, error) {
+	var sources []*verifySource
+	if kind == KindConfigMaps {
+		res, err := kubeclient.GetConfigMaps(config.SecretNamespace, labels)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range res.Items {
+			sources = append(sources, &verifySource{source: sourceName(KindConfigMaps, item.Namespace, item.Name), secret: secretFromConfigMap(item)})
+		}
+		return sources, nil
+	}
+	res, err := kubeclient.GetSecrets(config.SecretNamespace, labels)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range res.Items {
+		source := &verifySource{source: sourceName(KindSecrets, item.Namespace, item.Name)}
+		if kind == KindSubvalue {
+			if subvalueDisabled(item) {
+				continue
+			}
+			source.secret, source.err = subvalueSecret(item)
+		} else {
+			source.secret = secretFromSecret(item)
+		}
+		sources = append(sources, source)
+	}
+	return sources, nil
+}
+
+// verifySecret func compares secret with Secret Receiver, or with every receiver where the worst
+// result is the result of the secret
+func verifySecret(ctx context.Context, out io.Writer, secret *domain.Secret) *domain.Result {
+	repo := domain.GetRepository()
+	fanout, ok := repo.(domain.Fanout)
+	if !ok {
+		return verifySecretIn(ctx, out, repo, secret)
+	}
+	start := time.Now()
+	targets := fanout.Targets()
+	results := make([]*domain.Result, len(targets))
+	runTargets(out, targets, func(i int, target *domain.Target, out io.Writer) {
+		copied, err := target.Secret(secret)
+		if err != nil {
+			results[i] = NewResult(secret.Name, secret.Namespace, domain.ActionFailed, time.Now(), err)
+		} else {
+			results[i] = verifySecretIn(ctx, out, target.Repository, copied)
+		}
+		results[i].Target = target.Name
+	})
+	result := NewResult(secret.Name, secret.Namespace, domain.ActionInSync, start, nil)
+	result.ChecksumAfter = secret.Checksum
+	result.Targets = results
+	var errs []error
+	for _, target := range results {
+		if verifySeverity[target.Action] > verifySeverity[result.Action] {
+			result.Action = target.Action
+		}
+		if target.Error != "" {
+			errs = append(errs, fmt.Errorf("%s: %s", target.Target, target.Error))
+		}
+	}
+	if len(errs) != 0 {
+		result.Error = errors.Join(errs...).Error()
+	}
+	return result
+}
+
+// verifySecretIn func compares secret with the secret in repo, printing a key level diff with
+// values redacted when repo returns the secret data
+func verifySecretIn(ctx context.Context, out io.Writer, repo domain.Repository, secret *domain.Secret) *domain.Result {
+	start := time.Now()
+	status, err := checkSecret(ctx, repo, secret.Name, secret.Namespace)
+	result := NewResult(secret.Name, secret.Namespace, domain.ActionInSync, start, err)
+	result.ChecksumAfter = secret.Checksum
+	if err != nil {
+		fmt.Fprintf(out, "[ERROR] Secret %s in namespace %s: %v\n", secret.Name, secret.Namespace, err)
+		return result
+	}
+	result.ChecksumBefore = status.Checksum
+	switch {
+	case !status.Found:
+		result.Action = domain.ActionMissing
+		fmt.Fprintf(out, "[MISSING] Secret %s in namespace %s\n", secret.Name, secret.Namespace)
+	case checksumMatches(status.Checksum, secret):
+		fmt.Fprintf(out, "[OK] Secret %s in namespace %s is in sync\n", secret.Name, secret.Namespace)
+	default:
+		result.Action = domain.ActionDrifted
+		if checksumMigrates(status.Checksum, secret) {
+			fmt.Fprintf(out, "[DRIFT] Secret %s in namespace %s has a checksum of another version, publish it to store %s\n", secret.Name, secret.Namespace, secret.ChecksumVersion)
+			break
+		}
+		fmt.Fprintf(out, "[DRIFT] Secret %s in namespace %s\n", secret.Name, secret.Namespace)
+		if status.Secret != nil && status.Secret.Data != nil {
+			for _, line := range diffSecret(status.Secret, secret) {
+				fmt.Fprintf(out, "  %s\n", line)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,72 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/betorvs/secretpublisher/appcontext"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+// statusMock returns status in GetSecret
+type statusMock struct {
+	RepositoryMock
+	status *domain.SecretStatus
+}
+
+func (repo statusMock) GetSecret(ctx context.Context, name string, namespace string) (*domain.SecretStatus, error) {
+	return repo.status, nil
+}
+
+func TestVerifySecretIn(t *testing.T) {
+	secret := GenerateSecret("foo")
+	secret.Namespace = "default"
+	out := &bytes.Buffer{}
+	result := verifySecretIn(context.Background(), out, targetMock{checksum: secret.Checksum}, secret)
+	assert.Equal(t, domain.ActionInSync, result.Action)
+	assert.Equal(t, secret.Checksum, result.ChecksumBefore)
+	assert.Equal(t, secret.Checksum, result.ChecksumAfter)
+	assert.Contains(t, out.String(), "[OK] Secret foo in namespace default is in sync\n")
+
+	result = verifySecretIn(context.Background(), out, targetMock{}, secret)
+	assert.Equal(t, domain.ActionMissing, result.Action)
+	assert.Contains(t, out.String(), "[MISSING] Secret foo in namespace default\n")
+
+	remote := &domain.Secret{Name: "foo", Namespace: "default", Data: map[string]string{"old": "value"}}
+	result = verifySecretIn(context.Background(), out, statusMock{status: &domain.SecretStatus{Found: true, Checksum: "other", Secret: remote}}, secret)
+	assert.Equal(t, domain.ActionDrifted, result.Action)
+	assert.Equal(t, "other", result.ChecksumBefore)
+	assert.Contains(t, out.String(), "[DRIFT] Secret foo in namespace default\n  - old: (redacted)\n")
+	assert.NotContains(t, out.String(), "value")
+
+	result = verifySecretIn(context.Background(), out, targetMock{err: domain.ErrUnauthorized}, secret)
+	assert.Equal(t, domain.ActionFailed, result.Action)
+	assert.NotEmpty(t, result.Error)
+}
+
+func TestVerifySecretTargets(t *testing.T) {
+	secret := GenerateSecret("foo")
+	secret.Namespace = "default"
+	repo := fanoutMock{
+		targets: []*domain.Target{
+			{Name: "a", Repository: targetMock{checksum: secret.Checksum}},
+			{Name: "b", Repository: targetMock{checksum: "other"}},
+		},
+	}
+	appcontext.Current.Add(appcontext.Repository, repo)
+	out := &bytes.Buffer{}
+	result := verifySecret(context.Background(), out, secret)
+	assert.Equal(t, domain.ActionDrifted, result.Action)
+	assert.Len(t, result.Targets, 2)
+	assert.Equal(t, domain.ActionInSync, result.Targets[0].Action)
+	assert.Equal(t, "b", result.Targets[1].Target)
+	assert.Contains(t, out.String(), "[a] [OK] Secret foo in namespace default is in sync\n[b] [DRIFT] Secret foo in namespace default\n")
+
+	repo.targets = append(repo.targets, &domain.Target{Name: "c", Repository: targetMock{err: domain.ErrServer}})
+	appcontext.Current.Add(appcontext.Repository, repo)
+	result = verifySecret(context.Background(), out, secret)
+	assert.Equal(t, domain.ActionFailed, result.Action)
+	assert.Contains(t, result.Error, "c: ")
+}
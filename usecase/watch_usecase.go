@@ -0,0 +1,277 @@
+package usecase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/betorvs/secretpublisher/gateway/kubeclient"
+	"github.com/betorvs/secretpublisher/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// KindSecrets watches secrets like scan-secrets
+	KindSecrets = "secrets"
+	// KindConfigMaps watches config maps like scan-configmaps
+	KindConfigMaps = "configmaps"
+	// KindSubvalue watches secrets like secret-subvalue
+	KindSubvalue = "subvalue"
+	// watchShutdownGrace is how long queued items are still sent after SIGTERM or SIGINT,
+	// then the requests in progress are cancelled
+	watchShutdownGrace = 10 * time.Second
+)
+
+// watcher keeps the work queue and informer cache for one kind
+type watcher struct {
+	kind  string
+	queue workqueue.RateLimitingInterface
+	store cache.Store
+	// inv is nil when config.Prune is false
+	inv *inventory
+}
+
+// pruneItem is queued when a source is removed, with the secret to delete from Secret Receiver
+type pruneItem struct {
+	Name      string
+	Namespace string
+}
+
+// Watch func keeps sending secrets or config maps with labels to Secret Receiver
+// as they are added or updated, until ctx is done or SIGTERM or SIGINT.
+// With config.Prune, removed sources are deleted from Secret Receiver too.
+func Watch(ctx context.Context, kind, labels string) error {
+	if err := validatePrune(); err != nil {
+		return utils.ErrorHandler(err)
+	}
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	w := &watcher{
+		kind:  kind,
+		queue: workqueue.NewNamedRateLimitingQueue(workqueue.NewItemExponentialFailureRateLimiter(time.Second, 5*time.Minute), "secretpublisher"),
+	}
+	// load the inventory before the informer starts, event handlers and workers only read w.inv
+	if config.Prune {
+		inv, err := loadInventory(kind, labels)
+		if err != nil {
+			w.queue.ShutDown()
+			return utils.ErrorHandler(err)
+		}
+		w.inv = inv
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc: w.enqueue,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			w.enqueue(newObj)
+		},
+		DeleteFunc: w.enqueueDelete,
+	}
+	var err error
+	switch kind {
+	case KindConfigMaps:
+		w.store, err = kubeclient.WatchConfigMaps(ctx, config.SecretNamespace, labels, config.ResyncPeriod, handler)
+	default:
+		w.store, err = kubeclient.WatchSecrets(ctx, config.SecretNamespace, labels, config.ResyncPeriod, handler)
+	}
+	if err != nil {
+		w.queue.ShutDown()
+		return utils.ErrorHandler(err)
+	}
+	if w.inv != nil {
+		if err := w.pruneMissing(ctx); err != nil {
+			fmt.Fprintf(utils.Out(), "%v\n", err)
+		}
+	}
+	go watchKeyrings(ctx)
+	fmt.Fprintf(utils.Out(), "[INFO] Watching %s with label %s, resync every %s\n", kind, labels, config.ResyncPeriod)
+	// workers keep running after ctx is done, to send the queued items until the grace period ends
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+	var workers sync.WaitGroup
+	for i := 0; i < concurrency(); i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for w.processNextItem(workCtx) {
+			}
+		}()
+	}
+	<-ctx.Done()
+	fmt.Fprintln(utils.Out(), "[INFO] Shutting down")
+	w.queue.ShutDown()
+	done := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(watchShutdownGrace):
+		fmt.Fprintf(utils.Out(), "[INFO] Cancelling %d queued items after %s\n", w.queue.Len(), watchShutdownGrace)
+		cancelWork()
+		<-done
+	}
+	return nil
+}
+
+// enqueue func adds the object namespace/name to the queue
+func (w *watcher) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		fmt.Fprintf(utils.Out(), "[ERROR] %v\n", err)
+		return
+	}
+	w.queue.Add(key)
+}
+
+// enqueueDelete func adds the secret created from a removed object to the queue
+func (w *watcher) enqueueDelete(obj interface{}) {
+	if w.inv == nil {
+		return
+	}
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	secret, _ := secretFromObject(w.kind, obj)
+	if secret == nil {
+		return
+	}
+	w.queue.Add(pruneItem{Name: secret.Name, Namespace: secret.Namespace})
+}
+
+// pruneMissing func deletes secrets in the inventory whose source was removed while not watching
+func (w *watcher) pruneMissing(ctx context.Context) error {
+	current := make(map[string]bool)
+	for _, obj := range w.store.List() {
+		// kept, publish adds it to the inventory once it is sent
+		if item, ok := obj.(*v1.Secret); ok && w.kind == KindSubvalue {
+			// also when it has config.DisabledLabel, as secret-subvalue does
+			current[subvalueKey(*item)] = false
+			continue
+		}
+		secret, _ := secretFromObject(w.kind, obj)
+		if secret != nil {
+			current[secretKey(secret)] = false
+		}
+	}
+	results, err := w.inv.prune(ctx, current)
+	for _, result := range results {
+		printResult(result)
+	}
+	return err
+}
+
+// processNextItem func sends one object from the queue to Secret Receiver.
+// Failed objects are retried with rate limit up to config.WatchMaxRetries, unless ctx is done.
+// It returns false when the queue is shut down.
+func (w *watcher) processNextItem(ctx context.Context) bool {
+	item, shutdown := w.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer w.queue.Done(item)
+	var err error
+	switch queued := item.(type) {
+	case pruneItem:
+		err = w.prune(ctx, queued)
+	case string:
+		err = w.publish(ctx, queued)
+	}
+	if err == nil {
+		w.queue.Forget(item)
+		return true
+	}
+	if ctx.Err() != nil {
+		fmt.Fprintf(utils.Out(), "[ERROR] %s %v: %v, cancelled\n", w.kind, item, err)
+		w.queue.Forget(item)
+		return true
+	}
+	if w.queue.NumRequeues(item) < config.WatchMaxRetries {
+		fmt.Fprintf(utils.Out(), "[ERROR] %s %v: %v, retrying\n", w.kind, item, err)
+		w.queue.AddRateLimited(item)
+		return true
+	}
+	fmt.Fprintf(utils.Out(), "[ERROR] %s %v: %v, giving up after %d retries\n", w.kind, item, err, config.WatchMaxRetries)
+	w.queue.Forget(item)
+	return true
+}
+
+// publish func sends the object with key from the cache to Secret Receiver
+func (w *watcher) publish(ctx context.Context, key string) error {
+	obj, exists, err := w.store.GetByKey(key)
+	if err != nil || !exists {
+		return nil
+	}
+	secret, err := secretFromObject(w.kind, obj)
+	if err != nil || secret == nil {
+		return err
+	}
+	// print each item at once, workers run concurrently
+	var out bytes.Buffer
+	result, err := manageSecret(ctx, &out, secret.Name, secret)
+	utils.Out().Write(out.Bytes())
+	result.Source = sourceName(w.kind, secret.Namespace, secret.Name)
+	printResult(result)
+	if err != nil {
+		return err
+	}
+	if w.inv != nil && w.inv.set(secretKey(secret), true) {
+		return w.inv.save()
+	}
+	return nil
+}
+
+// prune func deletes a secret whose source was removed from Secret Receiver
+func (w *watcher) prune(ctx context.Context, item pruneItem) error {
+	start := time.Now()
+	err := deleteSecret(ctx, utils.Out(), item.Name, item.Namespace)
+	if errors.Is(err, domain.ErrNotFound) {
+		err = nil
+	}
+	printResult(NewResult(item.Name, item.Namespace, domain.ActionDeleted, start, err))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(utils.Out(), "[OK] Pruned %s/%s\n", item.Namespace, item.Name)
+	key := fmt.Sprintf("%s/%s", item.Namespace, item.Name)
+	if w.inv != nil && w.inv.set(key, false) {
+		return w.inv.save()
+	}
+	return nil
+}
+
+// printResult func prints one result to stdout as it happens, when config.Output is not text
+func printResult(result *domain.Result) {
+	if utils.Structured() {
+		utils.PrintResult(os.Stdout, config.Output, result)
+	}
+}
+
+// secretFromObject func converts an informer object using the same rules as the scan commands.
+// It returns nil when the object must be skipped.
+func secretFromObject(kind string, obj interface{}) (*domain.Secret, error) {
+	switch item := obj.(type) {
+	case *v1.ConfigMap:
+		return secretFromConfigMap(*item), nil
+	case *v1.Secret:
+		if kind != KindSubvalue {
+			return secretFromSecret(*item), nil
+		}
+		if subvalueDisabled(*item) {
+			fmt.Fprintf(utils.Out(), "Skiping secret %s \n", item.Name)
+			return nil, nil
+		}
+		return subvalueSecret(*item)
+	}
+	return nil, fmt.Errorf("unexpected object %T", obj)
+}
@@ -0,0 +1,111 @@
+package usecase
+
+import (
+	"context"
+	"testing"
+
+	"github.com/betorvs/secretpublisher/appcontext"
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestProcessNextItem(t *testing.T) {
+	defer keepRepositoryCalls()()
+	repo := RepositoryMock{}
+	appcontext.Current.Add(appcontext.Repository, repo)
+	config.WatchMaxRetries = 1
+	w := &watcher{
+		kind:  KindSecrets,
+		store: cache.NewStore(cache.MetaNamespaceKeyFunc),
+		queue: workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+	item := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Data:       map[string][]byte{"user": []byte("admin")},
+	}
+	assert.NoError(t, w.store.Add(item))
+	w.enqueue(item)
+	// removed from cache before being processed
+	w.enqueue(&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "bar", Namespace: "default"}})
+	posts := RepositoryPostSecretCalls
+	assert.True(t, w.processNextItem(context.Background()))
+	assert.True(t, w.processNextItem(context.Background()))
+	assert.Equal(t, posts+1, RepositoryPostSecretCalls)
+	assert.Equal(t, 0, w.queue.Len())
+	// without --prune deletions are ignored
+	w.enqueueDelete(item)
+	assert.Equal(t, 0, w.queue.Len())
+	// a prune item without inventory deletes the secret only
+	deletes := RepositoryDeleteCalls
+	w.queue.Add(pruneItem{Name: "foo", Namespace: "default"})
+	assert.True(t, w.processNextItem(context.Background()))
+	assert.Equal(t, deletes+1, RepositoryDeleteCalls)
+	// after the shutdown grace period failed items are not retried
+	var namespace string
+	appcontext.Current.Add(appcontext.Repository, targetMock{err: domain.ErrServer, namespace: &namespace})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w.enqueue(item)
+	assert.True(t, w.processNextItem(ctx))
+	assert.Equal(t, 0, w.queue.Len())
+	assert.Equal(t, 0, w.queue.NumRequeues("default/foo"))
+	w.queue.ShutDown()
+	assert.False(t, w.processNextItem(context.Background()))
+}
+
+func TestSecretFromObject(t *testing.T) {
+	config.NameSuffix = "copy"
+	defer func() { config.NameSuffix = "" }()
+	cm := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "default"},
+		Data:       map[string]string{"key": "value"},
+	}
+	secret, err := secretFromObject(KindConfigMaps, cm)
+	assert.NoError(t, err)
+	assert.Equal(t, "foo-copy", secret.Name)
+	assert.Equal(t, "value", secret.Data["key"])
+	_, err = secretFromObject(KindSecrets, "foo")
+	assert.Error(t, err)
+}
+
+func TestPruneMissingKeepsDisabled(t *testing.T) {
+	defer keepRepositoryCalls()()
+	appcontext.Current.Add(appcontext.Repository, RepositoryMock{})
+	config.MatchKey, config.KeyNameSuffix, config.DisabledLabel, config.DryRun = "config.password", "env", "skip=true", true
+	defer func() { config.MatchKey, config.KeyNameSuffix, config.DisabledLabel, config.DryRun = "", "", "", false }()
+	w := &watcher{
+		kind:  KindSubvalue,
+		store: cache.NewStore(cache.MetaNamespaceKeyFunc),
+		inv:   &inventory{entries: map[string]bool{"default/old-password-prod": true, "default/gone-password-prod": true}},
+	}
+	assert.NoError(t, w.store.Add(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "old", Namespace: "default", Labels: map[string]string{"skip": "true"}},
+		Data:       map[string][]byte{"config": []byte("password: def"), "env": []byte("prod")},
+	}))
+	deletes := RepositoryDeleteCalls
+	assert.NoError(t, w.pruneMissing(context.Background()))
+	// dry run: only the secret whose source is gone is planned for deletion
+	assert.Equal(t, deletes, RepositoryDeleteCalls)
+	assert.Equal(t, map[string]bool{"default/old-password-prod": true}, w.inv.entries)
+}
+
+func TestPublishSubvalueUnmarshalError(t *testing.T) {
+	defer keepRepositoryCalls()()
+	appcontext.Current.Add(appcontext.Repository, RepositoryMock{})
+	config.MatchKey, config.KeyNameSuffix = "config.password", "env"
+	defer func() { config.MatchKey, config.KeyNameSuffix = "", "" }()
+	w := &watcher{kind: KindSubvalue, store: cache.NewStore(cache.MetaNamespaceKeyFunc)}
+	assert.NoError(t, w.store.Add(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "broken", Namespace: "default"},
+		Data:       map[string][]byte{"config": []byte("password: [abc"), "env": []byte("prod")},
+	}))
+	posts := RepositoryPostSecretCalls
+	// skipped and returned as an error, as secret-subvalue does
+	assert.Error(t, w.publish(context.Background(), "default/broken"))
+	assert.Equal(t, posts, RepositoryPostSecretCalls)
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/betorvs/secretpublisher/config"
+	"github.com/betorvs/secretpublisher/domain"
+	"gopkg.in/yaml.v2"
+)
+
+// Out func returns where progress messages are printed. It is stdout for text output and
+// stderr for json, yaml and table, so stdout only has the report.
+func Out() io.Writer {
+	if Structured() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// Structured func returns true when config.Output is json, yaml or table
+func Structured() bool {
+	return config.Output != "" && config.Output != "text"
+}
+
+// PrintValue func writes v to w as indented json or yaml
+func PrintValue(w io.Writer, format string, v interface{}) error {
+	if format == "yaml" {
+		return yaml.NewEncoder(w).Encode(v)
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// PrintReport func writes report to w as json, yaml or table, or its message for text
+func PrintReport(w io.Writer, format string, report *domain.Report) error {
+	switch format {
+	case "json", "yaml":
+		return PrintValue(w, format, report)
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(tw, "NAMESPACE\tNAME\tACTION\tCHECKSUM\tDURATION\tERROR")
+		for _, result := range report.Results {
+			printRow(tw, result)
+		}
+		return tw.Flush()
+	}
+	_, err := fmt.Fprint(w, report.Message)
+	return err
+}
+
+// PrintConfigView func writes the effective configuration to w as json, yaml or a table
+func PrintConfigView(w io.Writer, format string, view *config.ConfigView) error {
+	if format == "json" || format == "yaml" {
+		return PrintValue(w, format, view)
+	}
+	if view.ConfigFile != "" {
+		fmt.Fprintf(w, "# config file: %s\n", view.ConfigFile)
+	}
+	if view.Profile != "" {
+		fmt.Fprintf(w, "# profile: %s\n", view.Profile)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tVALUE\tSOURCE")
+	for _, setting := range view.Settings {
+		value := setting.Value
+		if setting.Error != "" {
+			value = "invalid: " + setting.Error
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", setting.Name, value, setting.Source)
+	}
+	return tw.Flush()
+}
+
+// PrintResult func writes one result to w, json in a single line or one yaml document.
+// It is used by watch mode, where results are printed as they happen.
+func PrintResult(w io.Writer, format string, result *domain.Result) error {
+	switch format {
+	case "json":
+		return json.NewEncoder(w).Encode(result)
+	case "yaml":
+		out, err := yaml.Marshal(result)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "---\n%s", out)
+		return err
+	case "table":
+		printRow(w, result)
+	}
+	return nil
+}
+
+// printRow func writes one table row for result, and one row per target with the target
+// name after the secret name
+func printRow(w io.Writer, result *domain.Result) {
+	name := result.Name
+	if result.Target != "" {
+		name = fmt.Sprintf("%s@%s", result.Name, result.Target)
+	}
+	checksum := result.ChecksumAfter
+	if checksum == "" {
+		checksum = result.ChecksumBefore
+	}
+	fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%dms\t%s\n", result.Namespace, name, result.Action, shortChecksum(checksum), result.DurationMs, result.Error)
+	for _, target := range result.Targets {
+		printRow(w, target)
+	}
+}
+
+// shortChecksum func keeps the table readable with long checksums
+func shortChecksum(checksum string) string {
+	if len(checksum) > 16 {
+		return checksum[:16]
+	}
+	return checksum
+}
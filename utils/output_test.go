@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/betorvs/secretpublisher/domain"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestPrintReport(t *testing.T) {
+	report := &domain.Report{
+		Message: "OK",
+		Results: []*domain.Result{
+			{Name: "foo", Namespace: "default", Action: domain.ActionCreated, ChecksumAfter: "abc"},
+			{Name: "bar", Namespace: "default", Action: domain.ActionFailed, Error: "timeout"},
+		},
+	}
+
+	var out bytes.Buffer
+	assert.NoError(t, PrintReport(&out, "json", report))
+	decoded := &domain.Report{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), decoded))
+	assert.Equal(t, report, decoded)
+
+	out.Reset()
+	assert.NoError(t, PrintReport(&out, "yaml", report))
+	decoded = &domain.Report{}
+	assert.NoError(t, yaml.Unmarshal(out.Bytes(), decoded))
+	assert.Equal(t, report, decoded)
+
+	out.Reset()
+	assert.NoError(t, PrintReport(&out, "table", report))
+	assert.Contains(t, out.String(), "NAMESPACE")
+	assert.Contains(t, out.String(), "timeout")
+
+	out.Reset()
+	report.Results[0].Targets = []*domain.Result{{Name: "foo", Namespace: "prod", Action: domain.ActionCreated, Target: "cluster-b"}}
+	assert.NoError(t, PrintReport(&out, "table", report))
+	assert.Contains(t, out.String(), "foo@cluster-b")
+
+	out.Reset()
+	assert.NoError(t, PrintReport(&out, "text", report))
+	assert.Equal(t, "OK", out.String())
+}
+
+func TestPrintResult(t *testing.T) {
+	var out bytes.Buffer
+	result := &domain.Result{Name: "foo", Namespace: "default", Action: domain.ActionUpdated}
+	assert.NoError(t, PrintResult(&out, "json", result))
+	assert.Equal(t, 1, bytes.Count(out.Bytes(), []byte("\n")))
+}
@@ -1,15 +1,15 @@
 package utils
 
 import (
-	"errors"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"strings"
 )
 
-// ErrorHandler func
+// ErrorHandler func adds [ERROR] to the message, errors.Is and errors.As still work with the result
 func ErrorHandler(err error) error {
-	rerr := fmt.Sprintf("[ERROR]: %s", err)
-	return errors.New(rerr)
+	return fmt.Errorf("[ERROR]: %w", err)
 }
 
 // RemoveQuotes func
@@ -18,3 +18,10 @@ func RemoveQuotes(s string) string {
 	s = strings.TrimRight(s, "\n")
 	return s
 }
+
+// KeyFingerprint func returns the first 16 hex characters of the SHA-256 of a public key,
+// used as default key id
+func KeyFingerprint(public []byte) string {
+	sum := sha256.Sum256(public)
+	return hex.EncodeToString(sum[:8])
+}
@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
@@ -19,3 +20,9 @@ func TestErrorHandler(t *testing.T) {
 	testString := fmt.Sprintf("%v", test)
 	assert.Contains(t, testString, "[ERROR]")
 }
+
+func TestErrorHandlerWrap(t *testing.T) {
+	err := errors.New("test")
+	test := ErrorHandler(err)
+	assert.True(t, errors.Is(test, err))
+}